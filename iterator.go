@@ -603,10 +603,7 @@ func isDeletedOrExpired(meta byte, expiresAt uint64) bool {
 	if meta&bitDelete > 0 {
 		return true
 	}
-	if expiresAt == 0 {
-		return false
-	}
-	return expiresAt <= uint64(time.Now().Unix())
+	return y.IsExpired(expiresAt, time.Now())
 }
 
 // parseItem is a complex function because it needs to handle both forward and reverse iteration
@@ -143,7 +143,7 @@ func (itr *blockIterator) seek(key []byte, whence int) {
 		startIndex = itr.idx
 	}
 
-	foundEntryIdx := sort.Search(len(itr.entryOffsets), func(idx int) bool {
+	foundEntryIdx := y.SearchOffsets(itr.entryOffsets, func(idx int) bool {
 		// If idx is less than start index then just return false.
 		if idx < startIndex {
 			return false
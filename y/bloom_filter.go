@@ -0,0 +1,124 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"math"
+
+	"github.com/cespare/xxhash"
+	"github.com/pkg/errors"
+)
+
+// maxBloomProbes is the maximum number of bits set per key in a BloomFilter.
+const maxBloomProbes = 30
+
+// BloomFilter is a Bloom filter over 64-bit key hashes. Unlike Filter, which is built at once from
+// the 32-bit hashes of all the keys of a table, it can be built incrementally via Add, and the
+// wider hashes keep its false positive rate low for large sets. It can have false positives, where
+// Has returns true for a hash that wasn't added, but no false negatives. Filters can be persisted
+// via Encode, so the hashes must be stable across processes, e.g. as computed by AddKey and HasKey,
+// unlike MemHash. Its functions are not thread safe.
+type BloomFilter struct {
+	bits   []byte
+	nBits  uint64
+	probes uint8 // Number of bits set per key.
+}
+
+// NewBloomFilter returns a new BloomFilter sized for n keys with a false positive rate of about
+// fpRate.
+func NewBloomFilter(n int, fpRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	AssertTruef(fpRate > 0 && fpRate < 1, "Invalid bloom filter false positive rate: %f", fpRate)
+	// The optimal number of bits is -n*ln(fp)/ln(2)^2, with ln(2)*bits/n probes per key.
+	nBits := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	// For small n, we can see a very high false positive rate. Fix it by enforcing a minimum
+	// filter length, like appendFilter does.
+	if nBits < 64 {
+		nBits = 64
+	}
+	probes := math.Round(math.Ln2 * nBits / float64(n))
+	if probes < 1 {
+		probes = 1
+	}
+	if probes > maxBloomProbes {
+		probes = maxBloomProbes
+	}
+	nBytes := (int(nBits) + 7) / 8
+	return &BloomFilter{
+		bits:   make([]byte, nBytes, nBytes+1),
+		nBits:  uint64(nBytes) * 8,
+		probes: uint8(probes),
+	}
+}
+
+// Add adds hash to the filter.
+func (f *BloomFilter) Add(hash uint64) {
+	// Derive the probes from two halves of the hash, see "Less Hashing, Same Performance: Building
+	// a Better Bloom Filter" by Kirsch and Mitzenmacher.
+	delta := hash>>32 | hash<<32
+	for i := uint8(0); i < f.probes; i++ {
+		pos := hash % f.nBits
+		f.bits[pos/8] |= 1 << (pos % 8)
+		hash += delta
+	}
+}
+
+// Has returns true if hash may have been added to the filter, and false if it definitely wasn't.
+func (f *BloomFilter) Has(hash uint64) bool {
+	delta := hash>>32 | hash<<32
+	for i := uint8(0); i < f.probes; i++ {
+		pos := hash % f.nBits
+		if f.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+		hash += delta
+	}
+	return true
+}
+
+// AddKey adds key to the filter, hashing it with xxHash, which is stable across processes.
+func (f *BloomFilter) AddKey(key []byte) {
+	f.Add(xxhash.Sum64(key))
+}
+
+// HasKey returns true if key may have been added to the filter via AddKey.
+func (f *BloomFilter) HasKey(key []byte) bool {
+	return f.Has(xxhash.Sum64(key))
+}
+
+// Encode returns the encoded filter, which can be decoded by DecodeBloom. It consists of the bits
+// of the filter followed by a byte holding the number of probes. The returned slice shares memory
+// with the filter, so later calls to Add modify it.
+func (f *BloomFilter) Encode() []byte {
+	return append(f.bits, f.probes)
+}
+
+// DecodeBloom decodes a filter encoded by BloomFilter.Encode. The returned filter shares memory
+// with data, so it must not be modified while the filter is in use.
+func DecodeBloom(data []byte) (*BloomFilter, error) {
+	if len(data) < 2 {
+		return nil, errors.Errorf("Invalid bloom filter of length: %d", len(data))
+	}
+	probes := data[len(data)-1]
+	if probes < 1 || probes > maxBloomProbes {
+		return nil, errors.Errorf("Invalid number of bloom filter probes: %d", probes)
+	}
+	bits := data[:len(data)-1]
+	return &BloomFilter{bits: bits, nBits: uint64(len(bits)) * 8, probes: probes}, nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	for _, fpRate := range []float64{0.1, 0.01, 0.001} {
+		const n = 10000
+		f := NewBloomFilter(n, fpRate)
+		for i := 0; i < n; i++ {
+			f.AddKey([]byte(fmt.Sprintf("key%d", i)))
+		}
+		// No false negatives.
+		for i := 0; i < n; i++ {
+			require.True(t, f.HasKey([]byte(fmt.Sprintf("key%d", i))))
+		}
+
+		const tries = 100000
+		var fps int
+		for i := 0; i < tries; i++ {
+			if f.HasKey([]byte(fmt.Sprintf("missing%d", i))) {
+				fps++
+			}
+		}
+		rate := float64(fps) / tries
+		require.Less(t, rate, 1.5*fpRate, "target: %f", fpRate)
+		require.Greater(t, rate, fpRate/3, "target: %f", fpRate)
+	}
+}
+
+func TestBloomFilterEncode(t *testing.T) {
+	f := NewBloomFilter(100, 0.01)
+	for i := 0; i < 100; i++ {
+		f.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+	data := append([]byte{}, f.Encode()...)
+	d, err := DecodeBloom(data)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		require.Equal(t, f.HasKey(key), d.HasKey(key))
+	}
+
+	// Small filters are still usable.
+	f = NewBloomFilter(0, 0.01)
+	f.Add(42)
+	require.True(t, f.Has(42))
+	d, err = DecodeBloom(f.Encode())
+	require.NoError(t, err)
+	require.True(t, d.Has(42))
+
+	_, err = DecodeBloom(nil)
+	require.Error(t, err)
+	_, err = DecodeBloom([]byte{0xff, 0})
+	require.Error(t, err)
+	_, err = DecodeBloom([]byte{0xff, maxBloomProbes + 1})
+	require.Error(t, err)
+}
+
+func TestBloomFilterStableKeyHash(t *testing.T) {
+	// Filters are persisted, so keys must hash the same way in every process.
+	f := NewBloomFilter(2, 0.01)
+	f.AddKey([]byte("foo"))
+	f.AddKey([]byte("bar"))
+	require.Equal(t, "808280828082808216", fmt.Sprintf("%x", f.Encode()))
+}
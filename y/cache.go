@@ -0,0 +1,136 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// numCacheShards is the number of shards of a Cache. Each shard has its own lock and LRU list.
+const numCacheShards = 16
+
+// Cache is an LRU cache of byte slices, bounded by the total size of its keys and values. It's
+// sharded by MemHash of the keys to reduce lock contention, and each shard evicts its least
+// recently used entries independently. It's safe for concurrent use.
+type Cache struct {
+	// Keep the counters first, so that they're 64-bit aligned for atomic access.
+	hits   uint64
+	misses uint64
+	shards [numCacheShards]cacheShard
+}
+
+type cacheShard struct {
+	sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List // Of *cacheEntry, most recently used first.
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key string
+	val []byte
+}
+
+// NewCache returns a new Cache holding up to about maxBytes bytes of keys and values. Each shard
+// holds up to maxBytes/numCacheShards bytes, and entries larger than that are never cached.
+func NewCache(maxBytes int64) *Cache {
+	c := &Cache{}
+	for i := range c.shards {
+		c.shards[i].maxBytes = maxBytes / numCacheShards
+		c.shards[i].lru = list.New()
+		c.shards[i].entries = make(map[string]*list.Element)
+	}
+	return c
+}
+
+func (c *Cache) shard(key []byte) *cacheShard {
+	return &c.shards[MemHash(key)%numCacheShards]
+}
+
+// Get returns the value cached for key, and whether it was found. The returned slice must not be
+// modified.
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	s := c.shard(key)
+	s.Lock()
+	elem, ok := s.entries[string(key)]
+	var val []byte
+	if ok {
+		s.lru.MoveToFront(elem)
+		val = elem.Value.(*cacheEntry).val
+	}
+	s.Unlock()
+
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return val, ok
+}
+
+// Set caches val for key, evicting the least recently used entries of its shard if needed. The
+// key is copied, but val is retained by the cache, so it must not be modified afterwards.
+func (c *Cache) Set(key, val []byte) {
+	s := c.shard(key)
+	s.Lock()
+	defer s.Unlock()
+
+	if elem, ok := s.entries[string(key)]; ok {
+		s.remove(elem)
+	}
+	sz := int64(len(key) + len(val))
+	if sz > s.maxBytes {
+		return
+	}
+	for s.size+sz > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+	e := &cacheEntry{key: string(key), val: val}
+	s.entries[e.key] = s.lru.PushFront(e)
+	s.size += sz
+}
+
+func (s *cacheShard) remove(elem *list.Element) {
+	e := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.entries, e.key)
+	s.size -= int64(len(e.key) + len(e.val))
+}
+
+// Size returns the total size of the keys and values in the cache.
+func (c *Cache) Size() int64 {
+	var size int64
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.Lock()
+		size += s.size
+		s.Unlock()
+	}
+	return size
+}
+
+// Hits returns the number of calls to Get which found the key.
+func (c *Cache) Hits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+// Misses returns the number of calls to Get which didn't find the key.
+func (c *Cache) Misses() uint64 {
+	return atomic.LoadUint64(&c.misses)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(numCacheShards << 10)
+	_, ok := c.Get([]byte("foo"))
+	require.False(t, ok)
+
+	c.Set([]byte("foo"), []byte("bar"))
+	val, ok := c.Get([]byte("foo"))
+	require.True(t, ok)
+	require.Equal(t, []byte("bar"), val)
+	require.Equal(t, int64(6), c.Size())
+
+	// Overwriting a key replaces its value and size.
+	c.Set([]byte("foo"), []byte("bazz"))
+	val, ok = c.Get([]byte("foo"))
+	require.True(t, ok)
+	require.Equal(t, []byte("bazz"), val)
+	require.Equal(t, int64(7), c.Size())
+
+	require.Equal(t, uint64(2), c.Hits())
+	require.Equal(t, uint64(1), c.Misses())
+
+	// Entries larger than a shard are not cached.
+	c.Set([]byte("foo"), make([]byte, 2<<10))
+	_, ok = c.Get([]byte("foo"))
+	require.False(t, ok)
+	require.Equal(t, int64(0), c.Size())
+}
+
+func TestCacheEviction(t *testing.T) {
+	const maxBytes = numCacheShards << 10
+	c := NewCache(maxBytes)
+	val := make([]byte, 100)
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+
+	// Keep key 0 recently used, so that it's never evicted.
+	c.Set(key(0), val)
+	for i := 1; i < 10000; i++ {
+		c.Set(key(i), val)
+		_, ok := c.Get(key(0))
+		require.True(t, ok)
+		require.LessOrEqual(t, c.Size(), int64(maxBytes))
+	}
+	require.Greater(t, c.Size(), int64(maxBytes/2))
+
+	// The most recent keys are still cached, and the oldest ones were evicted.
+	_, ok := c.Get(key(9999))
+	require.True(t, ok)
+	for i := 1; i < 100; i++ {
+		_, ok := c.Get(key(i))
+		require.False(t, ok)
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := NewCache(1 << 20)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := []byte(fmt.Sprintf("key%d", (g*1000+i)%500))
+				if val, ok := c.Get(key); ok {
+					require.Equal(t, key, val)
+				} else {
+					c.Set(key, key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.Equal(t, uint64(8000), c.Hits()+c.Misses())
+	require.Greater(t, c.Hits(), uint64(0))
+}
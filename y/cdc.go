@@ -0,0 +1,100 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bufio"
+	"io"
+	"math"
+)
+
+// gearTable maps each byte to a random 64-bit value for the Gear rolling hash. It's generated from
+// a fixed seed, so chunk boundaries are stable across processes. Changing it would change all
+// chunk boundaries, and break dedup against previously stored chunks.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	// splitmix64, see http://xoshiro.di.unimi.it/splitmix64.c.
+	x := uint64(0x6a09e667f3bcc908)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// CDCReader splits the data read from an io.Reader into content-defined chunks. Chunk boundaries
+// are chosen by a Gear rolling hash over the data, so inserting or removing bytes only changes the
+// chunks around the edit, which makes them suitable for dedup. Its functions are not thread safe.
+type CDCReader struct {
+	r       *bufio.Reader
+	minSize int
+	maxSize int
+	// A boundary is placed after minSize bytes once the hash is below threshold.
+	threshold uint64
+	buf       []byte
+	err       error
+}
+
+// NewCDCReader returns a new CDCReader reading from r. Chunks are at least minSize and at most
+// maxSize bytes long, except for the last chunk which can be shorter than minSize. Chunks are on
+// average about avgSize bytes long, unless maxSize cuts many of them short. The sizes must satisfy
+// 0 < minSize < avgSize <= maxSize.
+func NewCDCReader(r io.Reader, minSize, avgSize, maxSize int) *CDCReader {
+	AssertTruef(0 < minSize && minSize < avgSize && avgSize <= maxSize,
+		"Invalid CDCReader sizes. min: %d avg: %d max: %d", minSize, avgSize, maxSize)
+	// After minSize bytes, each byte ends the chunk with a probability of 1/(avgSize-minSize), so
+	// that the rest of the chunk is avgSize-minSize bytes long on average. Comparing against a
+	// threshold depends on the top bits of the hash, which depend on the last 64 bytes. The bottom
+	// bits only depend on the last few bytes.
+	return &CDCReader{
+		r:         bufio.NewReader(r),
+		minSize:   minSize,
+		maxSize:   maxSize,
+		threshold: math.MaxUint64 / uint64(avgSize-minSize),
+		buf:       make([]byte, 0, maxSize),
+	}
+}
+
+// Next returns the next chunk. The returned slice is only valid until the next call to Next. It
+// returns io.EOF once all the data has been read, or any other error returned by the underlying
+// reader.
+func (c *CDCReader) Next() ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	chunk := c.buf[:0]
+	var hash uint64
+	for len(chunk) < c.maxSize {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.err = err
+			break
+		}
+		chunk = append(chunk, b)
+		hash = hash<<1 + gearTable[b]
+		if len(chunk) >= c.minSize && hash < c.threshold {
+			break
+		}
+	}
+	if len(chunk) == 0 {
+		return nil, c.err
+	}
+	return chunk, nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func cdcChunks(t *testing.T, data []byte) []string {
+	r := NewCDCReader(bytes.NewReader(data), 1<<10, 4<<10, 16<<10)
+	var chunks []string
+	for {
+		chunk, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		chunks = append(chunks, string(chunk))
+	}
+	_, err := r.Next()
+	require.Equal(t, io.EOF, err)
+	return chunks
+}
+
+func TestCDCReader(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := cdcChunks(t, data)
+	require.Greater(t, len(chunks), 50)
+	var joined []byte
+	for i, chunk := range chunks {
+		require.LessOrEqual(t, len(chunk), 16<<10)
+		if i < len(chunks)-1 {
+			require.GreaterOrEqual(t, len(chunk), 1<<10)
+		}
+		joined = append(joined, chunk...)
+	}
+	require.Equal(t, data, joined)
+
+	// Chunking the same data again yields the same boundaries.
+	require.Equal(t, chunks, cdcChunks(t, data))
+
+	// Inserting a byte only changes the chunks around it.
+	edited := make([]byte, 0, len(data)+1)
+	edited = append(edited, data[:len(data)/2]...)
+	edited = append(edited, 'x')
+	edited = append(edited, data[len(data)/2:]...)
+	editedChunks := cdcChunks(t, edited)
+
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		seen[chunk] = true
+	}
+	var changed int
+	for _, chunk := range editedChunks {
+		if !seen[chunk] {
+			changed++
+		}
+	}
+	require.Greater(t, changed, 0)
+	require.LessOrEqual(t, changed, 3)
+}
+
+func TestCDCReaderAvgSize(t *testing.T) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, sizes := range [][3]int{{1 << 10, 4 << 10, 16 << 10}, {256, 1000, 8 << 10}} {
+		r := NewCDCReader(bytes.NewReader(data), sizes[0], sizes[1], sizes[2])
+		var n, total int
+		for {
+			chunk, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			n++
+			total += len(chunk)
+		}
+		// The mean of geometrically distributed sizes over this many chunks is within a few
+		// percent of avgSize.
+		mean := float64(total) / float64(n)
+		require.InEpsilon(t, sizes[1], mean, 0.1, "sizes: %v", sizes)
+	}
+}
+
+func TestCDCReaderShortInput(t *testing.T) {
+	_, err := NewCDCReader(bytes.NewReader(nil), 8, 16, 32).Next()
+	require.Equal(t, io.EOF, err)
+
+	r := NewCDCReader(bytes.NewReader([]byte("foo")), 8, 16, 32)
+	chunk, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), chunk)
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+
+	errRead := io.ErrUnexpectedEOF
+	r = NewCDCReader(io.MultiReader(bytes.NewReader([]byte("foo")), &errReader{errRead}), 8, 16, 32)
+	chunk, err = r.Next()
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), chunk)
+	_, err = r.Next()
+	require.Equal(t, errRead, err)
+}
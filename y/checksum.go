@@ -17,7 +17,11 @@
 package y
 
 import (
+	"encoding/binary"
+	"hash"
 	"hash/crc32"
+	"io"
+	"io/ioutil"
 
 	"github.com/dgraph-io/badger/v3/pb"
 
@@ -48,3 +52,101 @@ func VerifyChecksum(data []byte, expected *pb.Checksum) error {
 	}
 	return nil
 }
+
+// ChecksumType is a checksum algorithm. Its values match those of pb.Checksum_Algorithm.
+type ChecksumType int
+
+const (
+	// CRC32C is the CRC32 checksum with the Castagnoli polynomial. It's the zero value, and hence
+	// the default.
+	CRC32C = ChecksumType(pb.Checksum_CRC32C)
+	// XXHash64 is the 64 bit xxHash checksum. It's faster than CRC32C on large inputs.
+	XXHash64 = ChecksumType(pb.Checksum_XXHash64)
+)
+
+// Checksum calculates checksum for data using t checksum type.
+func Checksum(data []byte, t ChecksumType) uint64 {
+	return CalculateChecksum(data, pb.Checksum_Algorithm(t))
+}
+
+// Verify validates the checksum of data using t checksum type against the expected sum.
+func Verify(data []byte, t ChecksumType, sum uint64) error {
+	return VerifyChecksum(data, &pb.Checksum{Algo: pb.Checksum_Algorithm(t), Sum: sum})
+}
+
+// ChecksumWriter is an io.Writer which computes a running CRC32C checksum of the data written
+// through it. Finish appends the checksum to the written data as a 4 byte trailer, which can be
+// verified by VerifyChecksumReader.
+type ChecksumWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+}
+
+// NewChecksumWriter returns a new ChecksumWriter writing to w.
+func NewChecksumWriter(w io.Writer) *ChecksumWriter {
+	return &ChecksumWriter{w: w, crc: crc32.New(CastagnoliCrcTable)}
+}
+
+// Write writes p to the underlying writer, adding the written bytes to the checksum.
+func (cw *ChecksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.crc.Write(p[:n])
+	return n, err
+}
+
+// Sum returns the checksum of the data written so far.
+func (cw *ChecksumWriter) Sum() uint32 {
+	return cw.crc.Sum32()
+}
+
+// Finish writes the checksum of the data written so far to the underlying writer. The writer must
+// not be used after calling Finish.
+func (cw *ChecksumWriter) Finish() error {
+	_, err := cw.w.Write(U32ToBytes(cw.crc.Sum32()))
+	return err
+}
+
+// VerifyChecksumReader reads all data from r, as written by a ChecksumWriter, and verifies the
+// trailing checksum. It returns the data without the checksum, or ErrChecksumMismatch if the
+// checksum doesn't match.
+func VerifyChecksumReader(r io.Reader) ([]byte, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 4 {
+		return nil, errors.Errorf("Data of length: %d is too short to hold a checksum", len(buf))
+	}
+	data, trailer := buf[:len(buf)-4], buf[len(buf)-4:]
+	expected := binary.BigEndian.Uint32(trailer)
+	if actual := crc32.Checksum(data, CastagnoliCrcTable); actual != expected {
+		return nil, Wrapf(ErrChecksumMismatch, "actual: %d, expected: %d", actual, expected)
+	}
+	return data, nil
+}
+
+// verifyingReader is the io.Reader returned by NewVerifyingReader.
+type verifyingReader struct {
+	r        io.Reader
+	crc      hash.Hash32
+	expected uint32
+}
+
+// NewVerifyingReader returns an io.Reader which reads from r and computes a running CRC32C
+// checksum of the data read. Once r returns io.EOF, the checksum is verified against expected, and
+// the final Read returns ErrChecksumMismatch instead of io.EOF if they don't match. The data is
+// streamed, so callers must not act on it until reaching io.EOF.
+func NewVerifyingReader(r io.Reader, expected uint32) io.Reader {
+	return &verifyingReader{r: r, crc: crc32.New(CastagnoliCrcTable), expected: expected}
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	n, err := vr.r.Read(p)
+	vr.crc.Write(p[:n])
+	if err == io.EOF {
+		if actual := vr.crc.Sum32(); actual != vr.expected {
+			return n, Wrapf(ErrChecksumMismatch, "actual: %d, expected: %d", actual, vr.expected)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumType(t *testing.T) {
+	var ct ChecksumType
+	require.Equal(t, CRC32C, ct)
+
+	data := []byte("123456789")
+	require.Equal(t, uint64(0xe3069283), Checksum(data, CRC32C))
+	require.Equal(t, uint64(0x44bc2cf5ad770999), Checksum([]byte("abc"), XXHash64))
+	require.Equal(t, uint64(0xef46db3751d8e999), Checksum(nil, XXHash64))
+
+	for _, ct := range []ChecksumType{CRC32C, XXHash64} {
+		sum := Checksum(data, ct)
+		require.NoError(t, Verify(data, ct, sum))
+		err := Verify(data, ct, sum+1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), ErrChecksumMismatch.Error())
+	}
+	// The types are not interchangeable.
+	require.Error(t, Verify(data, XXHash64, Checksum(data, CRC32C)))
+}
+
+func TestChecksumWriter(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.Read(data)
+
+	var buf bytes.Buffer
+	cw := NewChecksumWriter(&buf)
+	for i := 0; i < len(data); i += 100 {
+		n, err := cw.Write(data[i : i+100])
+		require.NoError(t, err)
+		require.Equal(t, 100, n)
+	}
+	require.Equal(t, crc32.Checksum(data, CastagnoliCrcTable), cw.Sum())
+	require.NoError(t, cw.Finish())
+	require.Equal(t, len(data)+4, buf.Len())
+
+	got, err := VerifyChecksumReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// Flip a byte of the data.
+	corrupt := Copy(buf.Bytes())
+	corrupt[10] ^= 0xff
+	_, err = VerifyChecksumReader(bytes.NewReader(corrupt))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ErrChecksumMismatch.Error())
+
+	_, err = VerifyChecksumReader(bytes.NewReader([]byte{1, 2}))
+	require.Error(t, err)
+}
+
+func TestVerifyingReader(t *testing.T) {
+	data := make([]byte, 10000)
+	rand.Read(data)
+	sum := crc32.Checksum(data, CastagnoliCrcTable)
+
+	got, err := ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(data), sum))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// Read in small chunks, so that the checksum is computed over many reads.
+	r := NewVerifyingReader(iotest.OneByteReader(bytes.NewReader(data)), sum)
+	got, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(data), sum+1))
+	require.Contains(t, err.Error(), ErrChecksumMismatch.Error())
+
+	corrupt := append([]byte{}, data...)
+	corrupt[5000] ^= 1
+	_, err = ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(corrupt), sum))
+	require.Contains(t, err.Error(), ErrChecksumMismatch.Error())
+
+	_, err = ioutil.ReadAll(NewVerifyingReader(bytes.NewReader(nil), 0))
+	require.NoError(t, err)
+}
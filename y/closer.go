@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io"
+	"log"
+	"math/rand"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// This file contains helpers around z.Closer, which is defined in ristretto.
+
+// ErrCopyCancelled is returned by CopyWithCloser when the closer is signalled before the copy
+// completes.
+var ErrCopyCancelled = errors.New("Copy cancelled by closer")
+
+// Signalled returns true if Signal has been called on lc, without blocking. It's a cheaper
+// alternative to a select on lc.HasBeenClosed() for tight loops. A nil Closer is considered
+// signalled, so that loops using it stop.
+func Signalled(lc *z.Closer) bool {
+	if lc == nil {
+		return true
+	}
+	select {
+	case <-lc.HasBeenClosed():
+		return true
+	default:
+		return false
+	}
+}
+
+// copyChunkSize is the size of chunks CopyWithCloser copies between checks of the closer.
+const copyChunkSize = 32 << 10
+
+// CopyWithCloser copies from src to dst like io.Copy, until either EOF is reached on src or an
+// error occurs. Between chunks, it checks whether lc has been signalled, in which case it stops
+// and returns ErrCopyCancelled. It returns the number of bytes copied, also when cancelled.
+func CopyWithCloser(dst io.Writer, src io.Reader, lc *z.Closer) (int64, error) {
+	buf := make([]byte, copyChunkSize)
+	var written int64
+	for {
+		if Signalled(lc) {
+			return written, ErrCopyCancelled
+		}
+		nr, rerr := src.Read(buf)
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+			if nw != nr {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// Every runs fn every d plus a random jitter in [0, jitter), until lc is signalled. It calls
+// lc.Done before returning, so it's meant to be run in its own goroutine after lc.AddRunning(1):
+//
+//	lc.AddRunning(1)
+//	go y.Every(lc, time.Minute, time.Second, runGC)
+func Every(lc *z.Closer, d, jitter time.Duration, fn func()) {
+	defer lc.Done()
+	for {
+		wait := d
+		if jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(jitter)))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			fn()
+		case <-lc.HasBeenClosed():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// NewChildCloser returns a new Closer with initial running goroutines, which is a child of
+// parent: signalling parent also signals the child, while the child can still be signalled on its
+// own. The child counts as running in parent until it has been signalled and all its goroutines
+// are done, so parent.Wait also waits for the goroutines of its children.
+func NewChildCloser(parent *z.Closer, initial int) *z.Closer {
+	child := z.NewCloser(initial)
+	parent.AddRunning(1)
+	go func() {
+		defer parent.Done()
+		select {
+		case <-parent.HasBeenClosed():
+			child.Signal()
+		case <-child.HasBeenClosed():
+		}
+		child.Wait()
+	}()
+	return child
+}
+
+// SafeGo runs fn in a new goroutine tracked by lc, i.e. it calls lc.AddRunning(1), and lc.Done
+// once fn returns. If fn panics, the panic is recovered and logged, and lc.Done is still called,
+// so that a panicking goroutine doesn't make lc.Wait hang.
+func SafeGo(lc *z.Closer, fn func()) {
+	lc.AddRunning(1)
+	go func() {
+		defer lc.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Recovered from panic in goroutine: %v\n%s", r, debug.Stack())
+			}
+		}()
+		fn()
+	}()
+}
+
+// CountingCloser is a z.Closer which also tracks the number of goroutines it's waiting on, e.g. to
+// log them during a hung shutdown, which the WaitGroup of z.Closer doesn't expose. The count is
+// only kept consistent if AddRunning and Done are called on the CountingCloser, not on the
+// embedded z.Closer, so the latter must not be passed to helpers calling Done, like Every.
+type CountingCloser struct {
+	*z.Closer
+	running int64
+}
+
+// NewCountingCloser returns a new CountingCloser with initial running goroutines.
+func NewCountingCloser(initial int) *CountingCloser {
+	return &CountingCloser{Closer: z.NewCloser(initial), running: int64(initial)}
+}
+
+// AddRunning adds delta to the number of running goroutines.
+func (lc *CountingCloser) AddRunning(delta int) {
+	atomic.AddInt64(&lc.running, int64(delta))
+	lc.Closer.AddRunning(delta)
+}
+
+// Done marks one of the running goroutines as done.
+func (lc *CountingCloser) Done() {
+	atomic.AddInt64(&lc.running, -1)
+	lc.Closer.Done()
+}
+
+// NumRunning returns the number of goroutines which haven't called Done yet.
+func (lc *CountingCloser) NumRunning() int {
+	return int(atomic.LoadInt64(&lc.running))
+}
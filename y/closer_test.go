@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignalled(t *testing.T) {
+	lc := z.NewCloser(0)
+	require.False(t, Signalled(lc))
+	lc.Signal()
+	require.True(t, Signalled(lc))
+	require.True(t, Signalled(nil))
+}
+
+// signallingReader signals a closer after a given number of reads.
+type signallingReader struct {
+	r     io.Reader
+	lc    *z.Closer
+	reads int
+}
+
+func (sr *signallingReader) Read(p []byte) (int, error) {
+	if sr.reads--; sr.reads == 0 {
+		sr.lc.Signal()
+	}
+	return sr.r.Read(p)
+}
+
+func TestCopyWithCloser(t *testing.T) {
+	data := make([]byte, 10*copyChunkSize)
+	rand.Read(data)
+
+	var dst bytes.Buffer
+	n, err := CopyWithCloser(&dst, bytes.NewReader(data), z.NewCloser(0))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, data, dst.Bytes())
+
+	// Signal the closer during the third read.
+	dst.Reset()
+	lc := z.NewCloser(0)
+	n, err = CopyWithCloser(&dst, &signallingReader{r: bytes.NewReader(data), lc: lc, reads: 3}, lc)
+	require.Equal(t, ErrCopyCancelled, err)
+	require.Equal(t, int64(3*copyChunkSize), n)
+	require.Equal(t, data[:n], dst.Bytes())
+
+	n, err = CopyWithCloser(&dst, bytes.NewReader(data), lc)
+	require.Equal(t, ErrCopyCancelled, err)
+	require.Zero(t, n)
+}
+
+func TestEvery(t *testing.T) {
+	lc := z.NewCloser(1)
+	var count int32
+	fired := make(chan struct{}, 100)
+	go Every(lc, 5*time.Millisecond, 5*time.Millisecond, func() {
+		atomic.AddInt32(&count, 1)
+		fired <- struct{}{}
+	})
+	for i := 0; i < 3; i++ {
+		select {
+		case <-fired:
+		case <-time.After(5 * time.Second):
+			t.Fatal("fn did not fire")
+		}
+	}
+
+	// Every must return promptly once signalled, and stop calling fn.
+	start := time.Now()
+	lc.SignalAndWait()
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	n := atomic.LoadInt32(&count)
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, n, atomic.LoadInt32(&count))
+	require.GreaterOrEqual(t, n, int32(3))
+}
+
+func TestNewChildCloser(t *testing.T) {
+	parent := z.NewCloser(0)
+	child := NewChildCloser(parent, 1)
+	grandchild := NewChildCloser(child, 1)
+	sibling := NewChildCloser(parent, 0)
+
+	var done int32
+	for _, lc := range []*z.Closer{child, grandchild} {
+		go func(lc *z.Closer) {
+			defer lc.Done()
+			<-lc.HasBeenClosed()
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		}(lc)
+	}
+
+	// Signalling a child doesn't signal its parent or siblings.
+	sibling.SignalAndWait()
+	require.False(t, Signalled(parent))
+	require.False(t, Signalled(child))
+
+	// Signalling the parent cascades to all children, and waits for their goroutines.
+	parent.SignalAndWait()
+	require.True(t, Signalled(child))
+	require.True(t, Signalled(grandchild))
+	require.Equal(t, int32(2), atomic.LoadInt32(&done))
+}
+
+func TestSafeGo(t *testing.T) {
+	lc := z.NewCloser(0)
+	var ran int32
+	SafeGo(lc, func() {
+		atomic.AddInt32(&ran, 1)
+		panic("worker failed")
+	})
+	SafeGo(lc, func() {
+		<-lc.HasBeenClosed()
+		atomic.AddInt32(&ran, 1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		lc.SignalAndWait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait didn't return after a worker panicked")
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&ran))
+}
+
+// waitFor polls cond until it returns true, failing t if that takes longer than timeout. It's used
+// instead of require.Eventually, which in testify v1.4.0 can panic if cond is still running when
+// it returns.
+func waitFor(t *testing.T, cond func() bool, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met after %s", timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCountingCloser(t *testing.T) {
+	lc := NewCountingCloser(2)
+	require.Equal(t, 2, lc.NumRunning())
+	lc.Done()
+	lc.Done()
+	require.Zero(t, lc.NumRunning())
+
+	// The count matches the number of outstanding Done calls of concurrent goroutines.
+	const n = 50
+	release := make(chan struct{})
+	lc.AddRunning(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			<-release
+			lc.Done()
+		}()
+	}
+	require.Equal(t, n, lc.NumRunning())
+	for i := n; i > 0; i-- {
+		require.Equal(t, i, lc.NumRunning())
+		release <- struct{}{}
+		want := i - 1
+		waitFor(t, func() bool { return lc.NumRunning() == want }, time.Second)
+	}
+
+	// It can be signalled and waited on like a z.Closer.
+	lc.AddRunning(1)
+	go func() {
+		defer lc.Done()
+		<-lc.HasBeenClosed()
+	}()
+	lc.SignalAndWait()
+	require.Zero(t, lc.NumRunning())
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import "context"
+
+// CollectErrors runs each of fns in its own goroutine, and waits for all of them to succeed. It
+// returns the first error returned by any of fns, or ctx.Err() if ctx is done first. In both cases
+// it returns early, without waiting for the remaining fns, which keep running in the background.
+// Use CollectErrorsCtx for fns which can be cancelled.
+func CollectErrors(ctx context.Context, fns ...func() error) error {
+	ctxFns := make([]func(context.Context) error, len(fns))
+	for i, fn := range fns {
+		fn := fn
+		ctxFns[i] = func(context.Context) error { return fn() }
+	}
+	return CollectErrorsCtx(ctx, ctxFns...)
+}
+
+// CollectErrorsCtx is CollectErrors for fns taking a context. Each fn is passed a context derived
+// from ctx, which is cancelled once CollectErrorsCtx returns, so that the remaining fns can stop
+// early after an error.
+func CollectErrorsCtx(ctx context.Context, fns ...func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered, so that fns still running after we return don't block forever.
+	errCh := make(chan error, len(fns))
+	for _, fn := range fns {
+		go func(fn func(context.Context) error) {
+			errCh <- fn(ctx)
+		}(fn)
+	}
+	for range fns {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectErrors(t *testing.T) {
+	var calls int32
+	fn := func() error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+	require.NoError(t, CollectErrors(context.Background(), fn, fn, fn))
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	require.NoError(t, CollectErrors(context.Background()))
+
+	errFoo := errors.New("foo")
+	block := make(chan struct{})
+	defer close(block)
+	err := CollectErrors(context.Background(), fn, func() error { return errFoo },
+		func() error {
+			<-block
+			return nil
+		})
+	require.Equal(t, errFoo, err)
+
+	// The deadline is honoured even though fn can't be cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = CollectErrors(ctx, fn, func() error {
+		<-block
+		return nil
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestCollectErrorsCtx(t *testing.T) {
+	errFoo := errors.New("foo")
+	cancelled := make(chan struct{})
+	err := CollectErrorsCtx(context.Background(),
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		},
+		func(ctx context.Context) error { return errFoo },
+	)
+	require.Equal(t, errFoo, err)
+	// The first error cancels the remaining fns.
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fn was not cancelled")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = CollectErrorsCtx(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, CollectErrorsCtx(context.Background(),
+		func(ctx context.Context) error { return nil },
+		func(ctx context.Context) error { return nil },
+	))
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Compressor compresses and decompresses blocks of data.
+type Compressor interface {
+	// Compress returns the compressed src. It reuses the memory of dst if it's large enough.
+	Compress(dst, src []byte) []byte
+	// Decompress returns the decompressed src. It reuses the memory of dst if it's large enough.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// NewCompressor returns the Compressor for ct. zstdLevel is the compression level used by ZSTD,
+// and is ignored by the other algorithms. options.None, the zero value of ct, returns a Compressor
+// which leaves the data as is, so that data written without compression stays readable.
+func NewCompressor(ct options.CompressionType, zstdLevel int) (Compressor, error) {
+	switch ct {
+	case options.None:
+		return noneCompressor{}, nil
+	case options.Snappy:
+		return snappyCompressor{}, nil
+	case options.ZSTD:
+		level := zstd.EncoderLevelFromZstd(zstdLevel)
+		// Don't share the package level encoder, whose level is fixed by its first user.
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+		if err != nil {
+			return nil, Wrapf(err, "While creating ZSTD encoder with level: %d.", zstdLevel)
+		}
+		return &zstdCompressor{enc: enc}, nil
+	default:
+		return nil, errors.Errorf("Unsupported compression type: %d", ct)
+	}
+}
+
+type noneCompressor struct{}
+
+func (noneCompressor) Compress(dst, src []byte) []byte {
+	return append(dst[:0], src...)
+}
+
+func (noneCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return append(dst[:0], src...), nil
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(dst, src []byte) []byte {
+	return snappy.Encode(dst[:cap(dst)], src)
+}
+
+func (snappyCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return snappy.Decode(dst[:cap(dst)], src)
+}
+
+type zstdCompressor struct {
+	enc *zstd.Encoder
+}
+
+func (c *zstdCompressor) Compress(dst, src []byte) []byte {
+	return c.enc.EncodeAll(src, dst[:0])
+}
+
+func (c *zstdCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	return ZSTDDecompress(dst, src)
+}
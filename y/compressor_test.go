@@ -0,0 +1,75 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3/options"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressor(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.Read(random)
+	inputs := map[string][]byte{
+		"empty":          nil,
+		"small":          []byte("foo"),
+		"compressible":   bytes.Repeat([]byte("badger "), 10000),
+		"incompressible": random,
+	}
+
+	for _, ct := range []options.CompressionType{options.None, options.Snappy, options.ZSTD} {
+		c, err := NewCompressor(ct, 1)
+		require.NoError(t, err)
+		for name, src := range inputs {
+			compressed := c.Compress(nil, src)
+			got, err := c.Decompress(nil, compressed)
+			require.NoError(t, err, "type: %d input: %s", ct, name)
+			require.True(t, bytes.Equal(src, got), "type: %d input: %s", ct, name)
+
+			// Round trip with reused buffers.
+			dst := make([]byte, 0, 1<<20)
+			compressed = c.Compress(dst, src)
+			got, err = c.Decompress(make([]byte, 0, 1<<20), compressed)
+			require.NoError(t, err, "type: %d input: %s", ct, name)
+			require.True(t, bytes.Equal(src, got), "type: %d input: %s", ct, name)
+
+			if name == "compressible" && ct != options.None {
+				require.Less(t, len(compressed), len(src)/10, "type: %d", ct)
+			}
+		}
+	}
+
+	// None leaves the data as is.
+	c, err := NewCompressor(options.CompressionType(0), 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), c.Compress(nil, []byte("foo")))
+
+	_, err = NewCompressor(options.CompressionType(42), 0)
+	require.Error(t, err)
+
+	// Corrupt input fails to decompress.
+	for _, ct := range []options.CompressionType{options.Snappy, options.ZSTD} {
+		c, err := NewCompressor(ct, 1)
+		require.NoError(t, err)
+		_, err = c.Decompress(nil, []byte("not compressed data"))
+		require.Error(t, err, "type: %d", ct)
+	}
+}
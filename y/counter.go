@@ -0,0 +1,99 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is an int64 counter for metrics. The zero value is a counter at zero, ready to use. It's
+// safe for concurrent use.
+type Counter struct {
+	val int64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.val, 1)
+}
+
+// Add adds n to the counter.
+func (c *Counter) Add(n int64) {
+	atomic.AddInt64(&c.val, n)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.val)
+}
+
+// Reset sets the counter back to zero.
+func (c *Counter) Reset() {
+	atomic.StoreInt64(&c.val, 0)
+}
+
+// CounterVec is a set of Counters keyed by a label, e.g. a table level or an operation. Counters
+// are created on first use of their label. The zero value is ready to use. It's safe for
+// concurrent use.
+type CounterVec struct {
+	sync.RWMutex
+	counters map[string]*Counter
+}
+
+// WithLabel returns the counter for label, creating it if needed. The counter can be retained to
+// avoid looking it up on every update.
+func (v *CounterVec) WithLabel(label string) *Counter {
+	v.RLock()
+	c, ok := v.counters[label]
+	v.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.Lock()
+	defer v.Unlock()
+	if c, ok := v.counters[label]; ok {
+		return c
+	}
+	if v.counters == nil {
+		v.counters = make(map[string]*Counter)
+	}
+	c = &Counter{}
+	v.counters[label] = c
+	return c
+}
+
+// Values returns the current values of all the counters, keyed by label.
+func (v *CounterVec) Values() map[string]int64 {
+	v.RLock()
+	defer v.RUnlock()
+	vals := make(map[string]int64, len(v.counters))
+	for label, c := range v.counters {
+		vals[label] = c.Value()
+	}
+	return vals
+}
+
+// Reset sets all the counters back to zero. Counters retained by callers remain valid.
+func (v *CounterVec) Reset() {
+	v.RLock()
+	defer v.RUnlock()
+	for _, c := range v.counters {
+		c.Reset()
+	}
+}
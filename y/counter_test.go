@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	require.Zero(t, c.Value())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc()
+				c.Add(2)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(8*3000), c.Value())
+
+	c.Add(-4000)
+	require.Equal(t, int64(20000), c.Value())
+	c.Reset()
+	require.Zero(t, c.Value())
+}
+
+func TestCounterVec(t *testing.T) {
+	var v CounterVec
+	require.Empty(t, v.Values())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				v.WithLabel(fmt.Sprintf("l%d", j%4)).Inc()
+			}
+			v.WithLabel("odd").Add(int64(i % 2))
+			v.Values()
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, map[string]int64{"l0": 2000, "l1": 2000, "l2": 2000, "l3": 2000, "odd": 4},
+		v.Values())
+
+	c := v.WithLabel("l0")
+	require.True(t, c == v.WithLabel("l0"))
+	v.Reset()
+	require.Zero(t, c.Value())
+	c.Inc()
+	require.Equal(t, int64(1), v.Values()["l0"])
+	require.Equal(t, int64(0), v.Values()["l1"])
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"sync"
+	"time"
+)
+
+// Debouncer coalesces bursts of triggers into a single call of a function, made once no trigger
+// has happened for an idle period, e.g. to flush after a burst of writes. It's safe for
+// concurrent use.
+type Debouncer struct {
+	sync.Mutex
+	idle    time.Duration
+	fn      func()
+	timer   *time.Timer
+	stopped bool
+}
+
+// NewDebouncer returns a new Debouncer calling fn, in its own goroutine, once idle has elapsed
+// after the last call to Trigger.
+func NewDebouncer(idle time.Duration, fn func()) *Debouncer {
+	return &Debouncer{idle: idle, fn: fn}
+}
+
+// Trigger schedules a call of fn after the idle period, postponing any call which is already
+// scheduled. It's a no-op once the Debouncer is stopped.
+func (d *Debouncer) Trigger() {
+	d.Lock()
+	defer d.Unlock()
+	if d.stopped {
+		return
+	}
+	if d.timer == nil {
+		d.timer = time.AfterFunc(d.idle, d.fire)
+		return
+	}
+	d.timer.Reset(d.idle)
+}
+
+func (d *Debouncer) fire() {
+	d.Lock()
+	stopped := d.stopped
+	d.Unlock()
+	if !stopped {
+		d.fn()
+	}
+}
+
+// Stop cancels any scheduled call of fn, and makes later triggers no-ops. It doesn't wait for a
+// call of fn which is already running.
+func (d *Debouncer) Stop() {
+	d.Lock()
+	defer d.Unlock()
+	d.stopped = true
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
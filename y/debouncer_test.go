@@ -0,0 +1,58 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebouncer(t *testing.T) {
+	var calls int32
+	d := NewDebouncer(100*time.Millisecond, func() { atomic.AddInt32(&calls, 1) })
+	defer d.Stop()
+
+	// Rapid triggers coalesce into a single call.
+	for i := 0; i < 10; i++ {
+		d.Trigger()
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.Zero(t, atomic.LoadInt32(&calls))
+	waitFor(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second)
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// A later trigger fires again.
+	d.Trigger()
+	waitFor(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second)
+}
+
+func TestDebouncerStop(t *testing.T) {
+	var calls int32
+	d := NewDebouncer(20*time.Millisecond, func() { atomic.AddInt32(&calls, 1) })
+	d.Stop() // Stopping before any trigger is fine.
+
+	d = NewDebouncer(20*time.Millisecond, func() { atomic.AddInt32(&calls, 1) })
+	d.Trigger()
+	d.Stop()
+	d.Trigger()
+	time.Sleep(60 * time.Millisecond)
+	require.Zero(t, atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,35 @@
+// +build !windows
+
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import "os"
+
+// SyncDir syncs the directory dir, making the entries of files created or renamed in it durable.
+func SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return Wrapf(err, "While opening directory: %s.", dir)
+	}
+	err = f.Sync()
+	closeErr := f.Close()
+	if err != nil {
+		return Wrapf(err, "While syncing directory: %s.", dir)
+	}
+	return Wrapf(closeErr, "While closing directory: %s.", dir)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import "sync"
+
+// EMA is an exponential moving average of float64 samples, such as write latencies. Each sample
+// moves the average by alpha times its difference from the average, so a larger alpha reacts
+// faster to changes and a smaller one smooths out noise more. It's safe for concurrent use.
+type EMA struct {
+	sync.Mutex
+	alpha float64
+	value float64
+	init  bool
+}
+
+// NewEMA returns a new EMA with the given alpha, which must be in (0, 1].
+func NewEMA(alpha float64) *EMA {
+	AssertTruef(alpha > 0 && alpha <= 1, "EMA alpha must be in (0, 1], got: %v", alpha)
+	return &EMA{alpha: alpha}
+}
+
+// Add adds sample to the average. The first sample sets the average.
+func (e *EMA) Add(sample float64) {
+	e.Lock()
+	defer e.Unlock()
+	if !e.init {
+		e.value, e.init = sample, true
+		return
+	}
+	e.value += e.alpha * (sample - e.value)
+}
+
+// Value returns the current average, or 0 if no samples have been added.
+func (e *EMA) Value() float64 {
+	e.Lock()
+	defer e.Unlock()
+	return e.value
+}
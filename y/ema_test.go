@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEMA(t *testing.T) {
+	e := NewEMA(0.2)
+	require.Zero(t, e.Value())
+	e.Add(10)
+	require.Equal(t, 10.0, e.Value())
+
+	// After a step from 10 to 100, the average converges toward 100 without overshooting it.
+	prev := e.Value()
+	for i := 0; i < 50; i++ {
+		e.Add(100)
+		require.True(t, e.Value() > prev && e.Value() <= 100, "value: %v", e.Value())
+		prev = e.Value()
+	}
+	require.InDelta(t, 100, e.Value(), 0.01)
+
+	// A larger alpha converges faster.
+	slow, fast := NewEMA(0.1), NewEMA(0.5)
+	for _, e := range []*EMA{slow, fast} {
+		e.Add(0)
+		for i := 0; i < 5; i++ {
+			e.Add(1)
+		}
+	}
+	require.True(t, fast.Value() > slow.Value())
+
+	one := NewEMA(1)
+	one.Add(3)
+	one.Add(7)
+	require.Equal(t, 7.0, one.Value())
+}
+
+func TestEMAConcurrent(t *testing.T) {
+	e := NewEMA(0.5)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				e.Add(5)
+				e.Value()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 5.0, e.Value())
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+var errLockNotSupported = errors.New("File locking is not supported on plan9")
+
+// lockFile returns an error, as plan9 doesn't support advisory locks.
+func lockFile(f *os.File, shared bool) error {
+	return errLockNotSupported
+}
+
+// unlockFile returns an error, as plan9 doesn't support advisory locks.
+func unlockFile(f *os.File) error {
+	return errLockNotSupported
+}
@@ -0,0 +1,39 @@
+// +build !windows,!plan9
+
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile acquires an advisory lock on f using flock, without blocking.
+func lockFile(f *os.File, shared bool) error {
+	opts := unix.LOCK_EX | unix.LOCK_NB
+	if shared {
+		opts = unix.LOCK_SH | unix.LOCK_NB
+	}
+	return unix.Flock(int(f.Fd()), opts)
+}
+
+// unlockFile releases the lock acquired by lockFile.
+func unlockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
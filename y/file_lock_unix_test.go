@@ -0,0 +1,69 @@
+// +build !windows,!plan9
+
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenExistingFileLocked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "MANIFEST")
+	require.NoError(t, ioutil.WriteFile(path, []byte("foo"), 0600))
+
+	f, unlock, err := OpenExistingFileLocked(path, 0)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// The file is locked exclusively, so neither exclusive nor shared locks can be acquired.
+	_, _, err = OpenExistingFileLocked(path, 0)
+	require.Error(t, err)
+	_, _, err = OpenExistingFileLocked(path, ReadOnly)
+	require.Error(t, err)
+
+	require.NoError(t, unlock())
+
+	// Shared locks can be held together, but exclude exclusive locks.
+	f1, unlock1, err := OpenExistingFileLocked(path, ReadOnly)
+	require.NoError(t, err)
+	defer f1.Close()
+	f2, unlock2, err := OpenExistingFileLocked(path, ReadOnly)
+	require.NoError(t, err)
+	defer f2.Close()
+	_, _, err = OpenExistingFileLocked(path, 0)
+	require.Error(t, err)
+	require.NoError(t, unlock1())
+	require.NoError(t, unlock2())
+
+	f3, unlock3, err := OpenExistingFileLocked(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, unlock3())
+	require.NoError(t, f3.Close())
+
+	_, _, err = OpenExistingFileLocked(filepath.Join(dir, "missing"), 0)
+	require.Error(t, err)
+}
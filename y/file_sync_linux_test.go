@@ -0,0 +1,68 @@
+// +build linux
+
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// O_SYNC and O_DSYNC are no-ops or aliases of each other on some platforms, so the open flags are
+// only checked on Linux, where O_SYNC is O_DSYNC plus a separate bit.
+func TestSyncFlagsSetOnFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	check := func(f *os.File, err error, flags Flags) {
+		require.NoError(t, err, "flags: %d", flags)
+		defer f.Close()
+		got, err := unix.FcntlInt(f.Fd(), unix.F_GETFL, 0)
+		require.NoError(t, err)
+		switch {
+		case flags&FullSync != 0:
+			require.Equal(t, unix.O_SYNC, got&unix.O_SYNC, "flags: %d", flags)
+		case flags&Sync != 0:
+			require.Equal(t, unix.O_DSYNC, got&unix.O_SYNC, "flags: %d", flags)
+		default:
+			require.Zero(t, got&unix.O_SYNC, "flags: %d", flags)
+			require.Zero(t, got&unix.O_DSYNC, "flags: %d", flags)
+		}
+	}
+
+	for _, flags := range []Flags{0, Sync, FullSync, Sync | FullSync} {
+		path := filepath.Join(dir, "MANIFEST")
+		f, err := CreateSyncedFileWithFlags(path, flags)
+		check(f, err, flags)
+		f, err = OpenSyncedFileWithFlags(path, flags)
+		check(f, err, flags)
+		f, err = OpenExistingFile(path, flags)
+		check(f, err, flags)
+		require.NoError(t, os.Remove(path))
+	}
+	f, err := CreateSyncedFile(filepath.Join(dir, "000001.vlog"), true)
+	check(f, err, Sync)
+	f, err = OpenSyncedFile(filepath.Join(dir, "000001.vlog"), false)
+	check(f, err, 0)
+}
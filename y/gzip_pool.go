@@ -0,0 +1,106 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+)
+
+// GzipWriterPool is a pool of gzip writers of a given compression level, so that streams can be
+// compressed without allocating a new writer, and its large internal state, for each of them.
+// It's safe for concurrent use.
+type GzipWriterPool struct {
+	level  int
+	pool   sync.Pool
+	allocs int32 // Number of writers allocated by the pool.
+}
+
+// NewGzipWriterPool returns a new GzipWriterPool of writers with the given level, which must be
+// valid for gzip.NewWriterLevel.
+func NewGzipWriterPool(level int) *GzipWriterPool {
+	AssertTruef(level >= gzip.HuffmanOnly && level <= gzip.BestCompression,
+		"Invalid gzip compression level: %d", level)
+	return &GzipWriterPool{level: level}
+}
+
+// Get returns a gzip writer writing to w, reusing one from the pool if possible. The writer must
+// be closed before being returned with Put.
+func (p *GzipWriterPool) Get(w io.Writer) *gzip.Writer {
+	if zw, ok := p.pool.Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return zw
+	}
+	atomic.AddInt32(&p.allocs, 1)
+	zw, err := gzip.NewWriterLevel(w, p.level)
+	Check(err)
+	return zw
+}
+
+// Put returns zw to the pool. zw must not be used after calling Put.
+func (p *GzipWriterPool) Put(zw *gzip.Writer) {
+	// Drop the reference to the underlying writer.
+	zw.Reset(ioutil.Discard)
+	p.pool.Put(zw)
+}
+
+// GzipReaderPool is a pool of gzip readers, like GzipWriterPool. It's safe for concurrent use.
+type GzipReaderPool struct {
+	pool   sync.Pool
+	allocs int32 // Number of readers allocated by the pool.
+}
+
+// NewGzipReaderPool returns a new, empty GzipReaderPool.
+func NewGzipReaderPool() *GzipReaderPool {
+	return &GzipReaderPool{}
+}
+
+// Get returns a gzip reader reading from r, reusing one from the pool if possible. It returns an
+// error if the gzip header can't be read from r.
+func (p *GzipReaderPool) Get(r io.Reader) (*gzip.Reader, error) {
+	if zr, ok := p.pool.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(r); err != nil {
+			p.Put(zr)
+			return nil, Wrapf(err, "While reading gzip header")
+		}
+		return zr, nil
+	}
+	atomic.AddInt32(&p.allocs, 1)
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, Wrapf(err, "While reading gzip header")
+	}
+	return zr, nil
+}
+
+// emptyGzip is a valid gzip stream of no data, which pooled readers are reset to.
+var emptyGzip = []byte{
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, // Header.
+	0x03, 0x00, // Empty final deflate block.
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // CRC-32 and size.
+}
+
+// Put returns zr to the pool. zr must not be used after calling Put.
+func (p *GzipReaderPool) Put(zr *gzip.Reader) {
+	// Drop the reference to the underlying reader. This can't fail for emptyGzip.
+	_ = zr.Reset(bytes.NewReader(emptyGzip))
+	p.pool.Put(zr)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipPools(t *testing.T) {
+	wp := NewGzipWriterPool(gzip.BestSpeed)
+	rp := NewGzipReaderPool()
+
+	const iterations = 20
+	for i := 0; i < iterations; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("backup-%d ", i)), 1000)
+
+		var buf bytes.Buffer
+		zw := wp.Get(&buf)
+		_, err := zw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		wp.Put(zw)
+		require.True(t, buf.Len() < len(data))
+
+		zr, err := rp.Get(&buf)
+		require.NoError(t, err)
+		got, err := ioutil.ReadAll(zr)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+		rp.Put(zr)
+	}
+	// Writers and readers are reused. The pools may drop some of them, e.g. on GC.
+	require.True(t, atomic.LoadInt32(&wp.allocs) < iterations, "allocs: %d", wp.allocs)
+	require.True(t, atomic.LoadInt32(&rp.allocs) < iterations, "allocs: %d", rp.allocs)
+
+	// Invalid data, both with a new reader and a reused one.
+	for i := 0; i < 2; i++ {
+		_, err := rp.Get(bytes.NewReader([]byte("not gzip")))
+		require.Error(t, err)
+	}
+}
+
+func TestGzipReaderPoolPut(t *testing.T) {
+	zr, err := gzip.NewReader(bytes.NewReader(emptyGzip))
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	// Put doesn't keep the source of a reader alive.
+	rp := NewGzipReaderPool()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err = gw.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	var collected int32
+	src := bytes.NewReader(buf.Bytes())
+	runtime.SetFinalizer(src, func(*bytes.Reader) { atomic.StoreInt32(&collected, 1) })
+	zr, err = rp.Get(src)
+	require.NoError(t, err)
+	src = nil
+	_, err = ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	rp.Put(zr)
+	for i := 0; i < 100 && atomic.LoadInt32(&collected) == 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&collected))
+	runtime.KeepAlive(zr)
+}
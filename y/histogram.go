@@ -0,0 +1,146 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"sync"
+)
+
+// numHistogramBuckets is the number of buckets of a Histogram. Bucket 0 holds values <= 0, and
+// bucket i > 0 holds values in [2^(i-1), 2^i).
+const numHistogramBuckets = 65
+
+// Histogram summarizes the distribution of int64 values, such as value sizes, using exponential
+// buckets. It keeps a constant amount of memory regardless of the number of values, at the cost of
+// approximate percentiles. It's safe for concurrent use.
+type Histogram struct {
+	sync.Mutex
+	buckets [numHistogramBuckets]int64
+	count   int64
+	sum     int64
+	min     int64
+	max     int64
+}
+
+// histogramBucket returns the index of the bucket holding n.
+func histogramBucket(n int64) int {
+	if n <= 0 {
+		return 0
+	}
+	return bits.Len64(uint64(n))
+}
+
+// histogramBounds returns the range [lo, hi) of values held by bucket i. hi of the last bucket
+// is capped to math.MaxInt64.
+func histogramBounds(i int) (int64, int64) {
+	if i == 0 {
+		return math.MinInt64, 1
+	}
+	lo := int64(1) << uint(i-1)
+	if i == numHistogramBuckets-1 {
+		return lo, math.MaxInt64
+	}
+	return lo, lo << 1
+}
+
+// Update adds n to the histogram.
+func (h *Histogram) Update(n int64) {
+	h.Lock()
+	defer h.Unlock()
+	if h.count == 0 || n < h.min {
+		h.min = n
+	}
+	if h.count == 0 || n > h.max {
+		h.max = n
+	}
+	h.buckets[histogramBucket(n)]++
+	h.count++
+	h.sum += n
+}
+
+// Percentile returns the approximate value below which a fraction p of the values fall, with p in
+// [0, 1]. It interpolates linearly within the bucket holding the percentile, so the result is
+// within a factor of two of the exact value. It returns 0 for an empty histogram.
+func (h *Histogram) Percentile(p float64) int64 {
+	h.Lock()
+	defer h.Unlock()
+	return h.percentile(p)
+}
+
+func (h *Histogram) percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 1 {
+		return h.max
+	}
+	rank := p * float64(h.count)
+	var seen int64
+	for i, cnt := range h.buckets {
+		if cnt == 0 || float64(seen+cnt) < rank {
+			seen += cnt
+			continue
+		}
+		lo, hi := histogramBounds(i)
+		// Only the values between min and max were seen.
+		if lo < h.min {
+			lo = h.min
+		}
+		if hi > h.max {
+			hi = h.max
+		}
+		frac := (rank - float64(seen)) / float64(cnt)
+		return lo + int64(frac*float64(hi-lo))
+	}
+	return h.max
+}
+
+// String returns a summary of the histogram, followed by the count of values in every non-empty
+// bucket.
+func (h *Histogram) String() string {
+	h.Lock()
+	defer h.Unlock()
+
+	var b strings.Builder
+	var mean float64
+	if h.count > 0 {
+		mean = float64(h.sum) / float64(h.count)
+	}
+	fmt.Fprintf(&b, "Count: %d Min: %d Max: %d Mean: %.2f P50: %d P90: %d P99: %d\n",
+		h.count, h.min, h.max, mean, h.percentile(0.5), h.percentile(0.9), h.percentile(0.99))
+	var cum int64
+	for i, cnt := range h.buckets {
+		if cnt == 0 {
+			continue
+		}
+		cum += cnt
+		lo, hi := histogramBounds(i)
+		if i == 0 {
+			fmt.Fprintf(&b, "[-inf, %d) %d %.2f%%\n", hi, cnt, 100*float64(cum)/float64(h.count))
+			continue
+		}
+		fmt.Fprintf(&b, "[%d, %d) %d %.2f%%\n", lo, hi, cnt, 100*float64(cum)/float64(h.count))
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &Histogram{}
+	require.Zero(t, h.Percentile(0.5))
+
+	// Uniform values in [1000, 2000).
+	for i := 1000; i < 2000; i++ {
+		h.Update(int64(i))
+	}
+	require.Equal(t, int64(1000), h.Percentile(0))
+	require.Equal(t, int64(1999), h.Percentile(1))
+	for _, p := range []float64{0.1, 0.5, 0.9, 0.99} {
+		want := 1000 + 1000*p
+		got := float64(h.Percentile(p))
+		require.InDelta(t, want, got, 100, "p: %f", p)
+	}
+
+	// 90% small values and 10% large ones.
+	h = &Histogram{}
+	for i := 0; i < 900; i++ {
+		h.Update(100)
+	}
+	for i := 0; i < 100; i++ {
+		h.Update(1 << 20)
+	}
+	// Percentiles are interpolated within the bucket of the small values, [64, 128).
+	for _, p := range []float64{0.5, 0.89} {
+		got := h.Percentile(p)
+		require.True(t, got >= 100 && got < 128, "p: %f got: %d", p, got)
+	}
+	require.Equal(t, int64(1<<20), h.Percentile(0.95))
+
+	s := h.String()
+	require.True(t, strings.HasPrefix(s, "Count: 1000 Min: 100 Max: 1048576"), s)
+	require.Contains(t, s, "[64, 128) 900 90.00%")
+	require.Contains(t, s, "[1048576, 2097152) 100 100.00%")
+}
+
+func TestHistogramExtremes(t *testing.T) {
+	h := &Histogram{}
+	h.Update(-5)
+	h.Update(0)
+	h.Update(math.MaxInt64)
+	require.Equal(t, int64(-5), h.Percentile(0))
+	require.Equal(t, int64(math.MaxInt64), h.Percentile(1))
+	require.Contains(t, h.String(), "[-inf, 1) 2")
+}
+
+func TestHistogramConcurrent(t *testing.T) {
+	h := &Histogram{}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				h.Update(rand.Int63n(1 << 20))
+				h.Percentile(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	require.True(t, strings.HasPrefix(h.String(), "Count: 8000 "))
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// KeyRange represents the range of keys [Left, Right). Both Left and Right are keys with
+// timestamps, ordered by CompareKeys. An empty Left or Right means the range is unbounded on that
+// side.
+type KeyRange struct {
+	Left  []byte
+	Right []byte
+}
+
+func (r KeyRange) String() string {
+	return fmt.Sprintf("[left=%x, right=%x)", r.Left, r.Right)
+}
+
+// Contains returns true if key lies within the range.
+func (r KeyRange) Contains(key []byte) bool {
+	if len(r.Left) > 0 && CompareKeys(key, r.Left) < 0 {
+		return false
+	}
+	return boundBefore(key, r.Right)
+}
+
+// Overlaps returns true if r and other have at least one key in common. Adjacent ranges, where the
+// Right of one is the Left of the other, don't overlap.
+func (r KeyRange) Overlaps(other KeyRange) bool {
+	// [a, b) and [c, d) overlap iff a < d and c < b.
+	return boundBefore(r.Left, other.Right) && boundBefore(other.Left, r.Right)
+}
+
+// boundBefore returns true if the left bound lies before the right bound. Empty bounds are
+// unbounded, so they always compare as before.
+func boundBefore(left, right []byte) bool {
+	return len(left) == 0 || len(right) == 0 || CompareKeys(left, right) < 0
+}
+
+// SplitRange splits r into up to n contiguous sub-ranges of roughly equal size, e.g. for scanning
+// them in parallel. The split points are picked by interpolating between the user keys of r.Left
+// and r.Right, treating the 8 bytes after their common prefix as numbers, so the sub-ranges are
+// equal in key space, not in the number of keys they hold. All versions of a user key end up in the
+// same sub-range. It returns fewer sub-ranges if r is too small to be split n ways.
+func SplitRange(r KeyRange, n int) []KeyRange {
+	if n <= 1 {
+		return []KeyRange{r}
+	}
+	var left, right []byte
+	if len(r.Left) > 0 {
+		left = ParseKey(r.Left)
+	}
+	if len(r.Right) > 0 {
+		right = ParseKey(r.Right)
+	}
+	prefixLen := 0
+	if len(r.Right) > 0 {
+		for prefixLen < len(left) && prefixLen < len(right) && left[prefixLen] == right[prefixLen] {
+			prefixLen++
+		}
+	}
+	prefix := left[:prefixLen]
+
+	// Interpret the next 8 bytes of both keys as numbers, padding them with zeros.
+	var buf [8]byte
+	copy(buf[:], left[prefixLen:])
+	lo := binary.BigEndian.Uint64(buf[:])
+	// An unbounded right is one past math.MaxUint64, so the span is hi-lo+carry.
+	hi, carry := uint64(math.MaxUint64), uint64(1)
+	if len(r.Right) > 0 {
+		buf = [8]byte{}
+		copy(buf[:], right[prefixLen:])
+		hi, carry = binary.BigEndian.Uint64(buf[:]), 0
+	}
+	if hi <= lo && carry == 0 {
+		return []KeyRange{r}
+	}
+
+	span, spanCarry := bits.Add64(hi-lo, carry, 0)
+	if spanCarry == 0 && span < uint64(n) {
+		n = int(span)
+	}
+	step, _ := bits.Div64(spanCarry, span, uint64(n))
+	out := make([]KeyRange, 0, n)
+	start := r.Left
+	for i := uint64(1); i < uint64(n); i++ {
+		binary.BigEndian.PutUint64(buf[:], lo+i*step)
+		userKey := append(append([]byte{}, prefix...), bytes.TrimRight(buf[:], "\x00")...)
+		// The highest timestamp sorts first, so that all versions of userKey are on the right.
+		split := KeyWithTs(userKey, math.MaxUint64)
+		// Skip split points which aren't strictly within the remaining range.
+		if !boundBefore(start, split) || !boundBefore(split, r.Right) {
+			continue
+		}
+		out = append(out, KeyRange{Left: start, Right: split})
+		start = split
+	}
+	return append(out, KeyRange{Left: start, Right: r.Right})
+}
+
+// boundNotAfter is boundBefore, but it also returns true if the bounds are equal.
+func boundNotAfter(left, right []byte) bool {
+	return len(left) == 0 || len(right) == 0 || CompareKeys(left, right) <= 0
+}
+
+// minLeft returns the smaller of the left bounds a and b, where empty means unbounded.
+func minLeft(a, b []byte) []byte {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	if CompareKeys(b, a) < 0 {
+		return b
+	}
+	return a
+}
+
+// maxRight returns the larger of the right bounds a and b, where empty means unbounded.
+func maxRight(a, b []byte) []byte {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	if CompareKeys(b, a) > 0 {
+		return b
+	}
+	return a
+}
+
+// KeyRangeSet is a set of keys represented as sorted, non-overlapping KeyRanges, e.g. to track
+// ranges of deleted keys. Its functions are not thread safe.
+type KeyRangeSet struct {
+	ranges []KeyRange
+}
+
+// NewKeyRangeSet returns a new, empty KeyRangeSet.
+func NewKeyRangeSet() *KeyRangeSet {
+	return &KeyRangeSet{}
+}
+
+// Add adds the keys in r to the set. Ranges in the set which overlap r or are adjacent to it are
+// merged with it into a single range. The set retains the keys of r, so they must not be modified
+// afterwards. Empty ranges are ignored.
+func (s *KeyRangeSet) Add(r KeyRange) {
+	if len(r.Left) > 0 && len(r.Right) > 0 && CompareKeys(r.Left, r.Right) >= 0 {
+		return
+	}
+	// Ranges before i end before r starts, and ranges from j on start after r ends.
+	i := 0
+	for i < len(s.ranges) && !boundNotAfter(r.Left, s.ranges[i].Right) {
+		i++
+	}
+	j := i
+	for ; j < len(s.ranges) && boundNotAfter(s.ranges[j].Left, r.Right); j++ {
+		r.Left = minLeft(r.Left, s.ranges[j].Left)
+		r.Right = maxRight(r.Right, s.ranges[j].Right)
+	}
+
+	if i == j {
+		s.ranges = append(s.ranges, KeyRange{})
+		copy(s.ranges[i+1:], s.ranges[i:])
+		s.ranges[i] = r
+		return
+	}
+	s.ranges[i] = r
+	s.ranges = append(s.ranges[:i+1], s.ranges[j:]...)
+}
+
+// Covers returns true if key lies within one of the ranges of the set.
+func (s *KeyRangeSet) Covers(key []byte) bool {
+	// Find the first range ending after key, which is the only one that can contain it.
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return boundBefore(key, s.ranges[i].Right)
+	})
+	return i < len(s.ranges) && s.ranges[i].Contains(key)
+}
+
+// Ranges returns the ranges of the set, in order.
+func (s *KeyRangeSet) Ranges() []KeyRange {
+	return append([]KeyRange{}, s.ranges...)
+}
+
+// EstimateKeysInRange estimates the number of keys in r from sortedSample, a uniform sample of the
+// totalKeys keys sorted by CompareKeys. The bounds of r are placed between the sample keys around
+// them by interpolating in key space, like SplitRange does, so the range can cover a fraction of a
+// sample key. The estimate is scaled to totalKeys before it is rounded, so these fractions aren't
+// lost for sparse samples.
+func EstimateKeysInRange(sortedSample [][]byte, totalKeys int, r KeyRange) int {
+	if len(sortedSample) == 0 {
+		return 0
+	}
+	right := float64(len(sortedSample))
+	if len(r.Right) > 0 {
+		right = sampleRank(sortedSample, r.Right)
+	}
+	var left float64
+	if len(r.Left) > 0 {
+		left = sampleRank(sortedSample, r.Left)
+	}
+	if right <= left {
+		return 0
+	}
+	return int(math.Round((right - left) * float64(totalKeys) / float64(len(sortedSample))))
+}
+
+// sampleRank returns the estimated rank of key in sample, where sample[i] is at rank i+0.5, i.e. in
+// the middle of the keys it stands for, and keys between sample keys are interpolated.
+func sampleRank(sample [][]byte, key []byte) float64 {
+	i := sort.Search(len(sample), func(i int) bool { return CompareKeys(sample[i], key) > 0 })
+	// sample[i-1] <= key < sample[i].
+	switch {
+	case i == 0:
+		return 0
+	case i == len(sample):
+		return float64(len(sample))
+	}
+	return float64(i) - 0.5 + keyFraction(sample[i-1], sample[i], key)
+}
+
+// keyFraction returns the position of key between the keys a <= key < b, from 0 at a to 1 at b. It
+// treats the 8 bytes of the user keys after the common prefix of a and b as numbers.
+func keyFraction(a, b, key []byte) float64 {
+	a, b, key = ParseKey(a), ParseKey(b), ParseKey(key)
+	prefixLen := 0
+	for prefixLen < len(a) && prefixLen < len(b) && a[prefixLen] == b[prefixLen] {
+		prefixLen++
+	}
+	num := func(k []byte) float64 {
+		var buf [8]byte
+		if len(k) > prefixLen {
+			copy(buf[:], k[prefixLen:])
+		}
+		return float64(binary.BigEndian.Uint64(buf[:]))
+	}
+	lo, hi := num(a), num(b)
+	if hi <= lo {
+		return 0
+	}
+	f := (num(key) - lo) / (hi - lo)
+	if f < 0 {
+		return 0
+	}
+	if f > 1 {
+		return 1
+	}
+	return f
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRangeContains(t *testing.T) {
+	k := func(key string, ts uint64) []byte { return KeyWithTs([]byte(key), ts) }
+
+	r := KeyRange{Left: k("b", 10), Right: k("d", 10)}
+	require.True(t, r.Contains(k("b", 10)))
+	require.True(t, r.Contains(k("c", 1)))
+	// Higher versions of the same key sort first, hence b@11 lies before the left bound.
+	require.False(t, r.Contains(k("b", 11)))
+	require.True(t, r.Contains(k("b", 9)))
+	require.True(t, r.Contains(k("d", 11)))
+	require.False(t, r.Contains(k("d", 10)))
+	require.False(t, r.Contains(k("a", 1)))
+	require.False(t, r.Contains(k("e", 1)))
+
+	require.True(t, KeyRange{Right: k("d", 10)}.Contains(k("a", 1)))
+	require.True(t, KeyRange{Left: k("b", 10)}.Contains(k("z", 1)))
+	require.True(t, KeyRange{}.Contains(k("z", 1)))
+}
+
+func TestKeyRangeOverlaps(t *testing.T) {
+	k := func(key string) []byte { return KeyWithTs([]byte(key), 0) }
+	r := func(left, right string) KeyRange {
+		var kr KeyRange
+		if left != "" {
+			kr.Left = k(left)
+		}
+		if right != "" {
+			kr.Right = k(right)
+		}
+		return kr
+	}
+
+	tests := []struct {
+		a, b     KeyRange
+		overlaps bool
+	}{
+		{r("a", "c"), r("b", "d"), true},
+		{r("a", "d"), r("b", "c"), true},
+		{r("a", "b"), r("b", "c"), false}, // Adjacent.
+		{r("a", "b"), r("c", "d"), false}, // Disjoint.
+		{r("", "b"), r("a", "c"), true},
+		{r("", "b"), r("b", ""), false},
+		{r("", "c"), r("b", ""), true},
+		{r("", ""), r("x", "y"), true},
+		{r("", ""), r("", ""), true},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.overlaps, tc.a.Overlaps(tc.b), "%s %s", tc.a, tc.b)
+		require.Equal(t, tc.overlaps, tc.b.Overlaps(tc.a), "%s %s", tc.b, tc.a)
+	}
+}
+
+func TestKeyRangeSet(t *testing.T) {
+	k := func(key string) []byte { return KeyWithTs([]byte(key), 0) }
+	r := func(left, right string) KeyRange {
+		kr := KeyRange{}
+		if left != "" {
+			kr.Left = k(left)
+		}
+		if right != "" {
+			kr.Right = k(right)
+		}
+		return kr
+	}
+
+	s := NewKeyRangeSet()
+	require.False(t, s.Covers(k("a")))
+
+	s.Add(r("c", "e"))
+	s.Add(r("m", "p"))
+	s.Add(r("g", "h"))
+	require.Equal(t, []KeyRange{r("c", "e"), r("g", "h"), r("m", "p")}, s.Ranges())
+
+	// Empty ranges are ignored.
+	s.Add(r("x", "x"))
+	s.Add(r("z", "y"))
+	require.Len(t, s.Ranges(), 3)
+
+	for key, want := range map[string]bool{
+		"a": false, "c": true, "d": true, "e": false, "f": false, "g": true,
+		"h": false, "m": true, "o": true, "p": false, "z": false,
+	} {
+		require.Equal(t, want, s.Covers(k(key)), "key: %s", key)
+	}
+
+	// Adjacent ranges are merged.
+	s.Add(r("e", "f"))
+	require.Equal(t, []KeyRange{r("c", "f"), r("g", "h"), r("m", "p")}, s.Ranges())
+	s.Add(r("b", "c"))
+	require.Equal(t, []KeyRange{r("b", "f"), r("g", "h"), r("m", "p")}, s.Ranges())
+
+	// Overlapping ranges are merged, also across several ranges.
+	s.Add(r("d", "n"))
+	require.Equal(t, []KeyRange{r("b", "p")}, s.Ranges())
+	require.True(t, s.Covers(k("f")))
+	require.True(t, s.Covers(k("j")))
+
+	// A range contained in another doesn't change the set.
+	s.Add(r("c", "d"))
+	require.Equal(t, []KeyRange{r("b", "p")}, s.Ranges())
+
+	// Unbounded ranges.
+	s.Add(r("s", ""))
+	require.Equal(t, []KeyRange{r("b", "p"), r("s", "")}, s.Ranges())
+	require.True(t, s.Covers(k("zzz")))
+	require.False(t, s.Covers(k("q")))
+	s.Add(r("", "a"))
+	require.Equal(t, []KeyRange{r("", "a"), r("b", "p"), r("s", "")}, s.Ranges())
+	require.True(t, s.Covers(k("")))
+	s.Add(r("o", "t"))
+	require.Equal(t, []KeyRange{r("", "a"), r("b", "")}, s.Ranges())
+	s.Add(r("", ""))
+	require.Equal(t, []KeyRange{r("", "")}, s.Ranges())
+	require.True(t, s.Covers(k("q")))
+}
+
+func TestSplitRange(t *testing.T) {
+	k := func(key string) []byte { return KeyWithTs([]byte(key), math.MaxUint64) }
+	check := func(r KeyRange, parts []KeyRange) {
+		require.Equal(t, r.Left, parts[0].Left)
+		require.Equal(t, r.Right, parts[len(parts)-1].Right)
+		for i, p := range parts {
+			if i > 0 {
+				require.Equal(t, parts[i-1].Right, p.Left)
+			}
+			require.True(t, boundBefore(p.Left, p.Right), "part: %s", p)
+		}
+	}
+
+	r := KeyRange{Left: k("a"), Right: k("z")}
+	parts := SplitRange(r, 4)
+	require.Len(t, parts, 4)
+	check(r, parts)
+	// The split points are roughly equally spaced between a and z.
+	for i, want := range []byte{'g', 'm', 's'} {
+		require.Equal(t, want, ParseKey(parts[i].Right)[0])
+	}
+	// Every key lies in exactly one part, including all versions of the split points.
+	for _, key := range [][]byte{
+		k("a"), k("b"), k("g"), KeyWithTs([]byte("g@"), 1), k("mzz"), k("s"), k("yzzz"),
+	} {
+		var n int
+		for _, p := range parts {
+			if p.Contains(key) {
+				n++
+			}
+		}
+		require.Equal(t, 1, n, "key: %q", key)
+	}
+	for _, p := range parts[1:] {
+		userKey := ParseKey(p.Left)
+		require.True(t, p.Contains(KeyWithTs(userKey, 1)))
+		require.True(t, p.Contains(KeyWithTs(userKey, math.MaxUint64)))
+	}
+
+	require.Equal(t, []KeyRange{r}, SplitRange(r, 1))
+
+	// Keys sharing a long prefix.
+	r = KeyRange{Left: k("tenant1/user0001"), Right: k("tenant1/user9999")}
+	parts = SplitRange(r, 8)
+	require.Len(t, parts, 8)
+	check(r, parts)
+
+	// A range too small to split n ways.
+	r = KeyRange{Left: k("a"), Right: k("a\x00\x00\x00\x00\x00\x00\x00\x02")}
+	parts = SplitRange(r, 4)
+	require.Len(t, parts, 2)
+	check(r, parts)
+	r = KeyRange{Left: k("a"), Right: k("a")}
+	require.Equal(t, []KeyRange{r}, SplitRange(r, 4))
+
+	// Unbounded ranges.
+	parts = SplitRange(KeyRange{}, 4)
+	require.Len(t, parts, 4)
+	check(KeyRange{}, parts)
+	require.Equal(t, []byte{0x40}, ParseKey(parts[0].Right))
+	parts = SplitRange(KeyRange{Left: k("m")}, 2)
+	require.Len(t, parts, 2)
+	check(KeyRange{Left: k("m")}, parts)
+}
+
+func TestEstimateKeysInRange(t *testing.T) {
+	// Keys with uniformly distributed user keys, sampling every 100th one.
+	r := rand.New(rand.NewSource(1))
+	const n, every = 100000, 100
+	keys := make([][]byte, n)
+	for i := range keys {
+		var buf [8]byte
+		r.Read(buf[:])
+		keys[i] = KeyWithTs(append([]byte("prefix"), buf[:]...), 1)
+	}
+	sort.Slice(keys, func(i, j int) bool { return CompareKeys(keys[i], keys[j]) < 0 })
+	var sample [][]byte
+	for i := every / 2; i < n; i += every {
+		sample = append(sample, keys[i])
+	}
+
+	count := func(kr KeyRange) int {
+		var c int
+		for _, key := range keys {
+			if kr.Contains(key) {
+				c++
+			}
+		}
+		return c
+	}
+	k := func(key []byte) []byte { return KeyWithTs(key, math.MaxUint64) }
+	ranges := []KeyRange{
+		{},
+		{Left: keys[n/2]},
+		{Right: keys[n/3]},
+		{Left: k([]byte("a")), Right: k([]byte("z"))},
+		{Left: k([]byte("prefix\x40")), Right: k([]byte("prefix\xc0"))},
+	}
+	for i := 0; i < 20; i++ {
+		a, b := r.Intn(n), r.Intn(n)
+		if a > b {
+			a, b = b, a
+		}
+		ranges = append(ranges, KeyRange{Left: keys[a], Right: keys[b]})
+	}
+	for _, kr := range ranges {
+		got, want := EstimateKeysInRange(sample, n, kr), count(kr)
+		// Allow for an error of about one sample key around each bound.
+		require.InDelta(t, want, got, 2*every, "range: %s", kr)
+	}
+
+	// Ranges outside of the sample, and empty ones.
+	require.Zero(t, EstimateKeysInRange(sample, n, KeyRange{Right: k([]byte("a"))}))
+	require.Zero(t, EstimateKeysInRange(sample, n, KeyRange{Left: k([]byte("z"))}))
+	require.Zero(t, EstimateKeysInRange(sample, n, KeyRange{Left: keys[500], Right: keys[400]}))
+	require.Zero(t, EstimateKeysInRange(nil, n, KeyRange{}))
+	require.Equal(t, n, EstimateKeysInRange(sample, n, KeyRange{}))
+	require.Equal(t, len(sample), EstimateKeysInRange(sample, len(sample), KeyRange{}))
+
+	// Fractions of a sample key are scaled before rounding. The range from the first sample key to
+	// half way to the second one covers half a sample key, where each one stands for 1000 keys.
+	sparse := [][]byte{k([]byte{0x00}), k([]byte{0x80}), k([]byte{0xff})}
+	kr := KeyRange{Left: sparse[0], Right: k([]byte{0x40})}
+	require.Equal(t, 1, EstimateKeysInRange(sparse, len(sparse), kr))
+	require.Equal(t, 500, EstimateKeysInRange(sparse, 3000, kr))
+	kr = KeyRange{Left: k([]byte{0x20}), Right: k([]byte{0x40})}
+	require.Zero(t, EstimateKeysInRange(sparse, len(sparse), kr))
+	require.Equal(t, 250, EstimateKeysInRange(sparse, 3000, kr))
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+)
+
+// mergeHeap is a min-heap of the heads of sorted key lists, ordered by CompareKeys. Ties are
+// broken by list index, to keep the merge stable.
+type mergeHeap []mergeHead
+
+type mergeHead struct {
+	key []byte
+	idx int // Index of the list the key came from.
+}
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if cmp := CompareKeys(h[i].key, h[j].key); cmp != 0 {
+		return cmp < 0
+	}
+	return h[i].idx < h[j].idx
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+// MergeSortedKeys merges lists of keys, each sorted by CompareKeys, into a single list sorted by
+// CompareKeys. Keys which are present multiple times, with the same timestamp, are only returned
+// once. The returned list shares the keys with lists.
+func MergeSortedKeys(lists [][][]byte) [][]byte {
+	total := 0
+	h := make(mergeHeap, 0, len(lists))
+	for i, list := range lists {
+		total += len(list)
+		if len(list) > 0 {
+			h = append(h, mergeHead{key: list[0], idx: i})
+		}
+	}
+	heap.Init(&h)
+
+	out := make([][]byte, 0, total)
+	pos := make([]int, len(lists)) // Position of the head of each list.
+	for len(h) > 0 {
+		head := h[0]
+		if len(out) == 0 || CompareKeys(out[len(out)-1], head.key) != 0 {
+			out = append(out, head.key)
+		}
+
+		pos[head.idx]++
+		if list := lists[head.idx]; pos[head.idx] < len(list) {
+			h[0].key = list[pos[head.idx]]
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return out
+}
+
+// FrameReader reads a sequence of frames, as written by PageBuffer.WriteFrame. Next returns the
+// payload of the next frame, or io.EOF if there are no more frames.
+type FrameReader interface {
+	Next() ([]byte, error)
+}
+
+// ioFrameReader is the FrameReader returned by NewFrameReader.
+type ioFrameReader struct {
+	r *bufio.Reader
+}
+
+// NewFrameReader returns a FrameReader reading frames from r using NextFrame. It buffers reads
+// from r, so r must not be read from directly afterwards.
+func NewFrameReader(r io.Reader) FrameReader {
+	return &ioFrameReader{r: bufio.NewReader(r)}
+}
+
+func (fr *ioFrameReader) Next() ([]byte, error) {
+	return NextFrame(fr.r)
+}
+
+// MergeFiles merges the keys read from readers, each a sequence of frames sorted by CompareKeys,
+// and writes them to out as frames sorted by CompareKeys. Keys which are present multiple times,
+// with the same timestamp, are only written once. Only the current key of each reader is held in
+// memory, so the inputs can be larger than memory.
+func MergeFiles(out io.Writer, readers []FrameReader) error {
+	h := make(mergeHeap, 0, len(readers))
+	for i, r := range readers {
+		key, err := r.Next()
+		switch {
+		case err == io.EOF:
+		case err != nil:
+			return Wrapf(err, "While reading key from reader: %d", i)
+		default:
+			h = append(h, mergeHead{key: key, idx: i})
+		}
+	}
+	heap.Init(&h)
+
+	bw := bufio.NewWriter(out)
+	var last []byte
+	var hdr [binary.MaxVarintLen64]byte
+	for len(h) > 0 {
+		head := h[0]
+		if last == nil || CompareKeys(last, head.key) != 0 {
+			n := binary.PutUvarint(hdr[:], uint64(len(head.key)))
+			if _, err := bw.Write(hdr[:n]); err != nil {
+				return Wrapf(err, "While writing merged keys")
+			}
+			if _, err := bw.Write(head.key); err != nil {
+				return Wrapf(err, "While writing merged keys")
+			}
+			last = head.key
+		}
+
+		key, err := readers[head.idx].Next()
+		switch {
+		case err == io.EOF:
+			heap.Pop(&h)
+		case err != nil:
+			return Wrapf(err, "While reading key from reader: %d", head.idx)
+		default:
+			h[0].key = key
+			heap.Fix(&h, 0)
+		}
+	}
+	return Wrapf(bw.Flush(), "While writing merged keys")
+}
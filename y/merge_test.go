@@ -0,0 +1,130 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSortedKeys(t *testing.T) {
+	k := func(key string, ts uint64) []byte { return KeyWithTs([]byte(key), ts) }
+
+	lists := [][][]byte{
+		{k("a", 2), k("a", 1), k("c", 5)},
+		{},
+		{k("a", 3), k("b", 1), k("c", 5), k("d", 1)},
+		{k("a", 1)},
+	}
+	want := [][]byte{k("a", 3), k("a", 2), k("a", 1), k("b", 1), k("c", 5), k("d", 1)}
+	require.Equal(t, want, MergeSortedKeys(lists))
+
+	require.Empty(t, MergeSortedKeys(nil))
+	require.Empty(t, MergeSortedKeys([][][]byte{{}, {}}))
+	require.Equal(t, [][]byte{k("a", 1)}, MergeSortedKeys([][][]byte{{k("a", 1)}}))
+}
+
+func TestMergeSortedKeysRandom(t *testing.T) {
+	var lists [][][]byte
+	seen := make(map[string]bool)
+	var all [][]byte
+	for i := 0; i < 5; i++ {
+		var list [][]byte
+		for j := 0; j < 100; j++ {
+			key := KeyWithTs([]byte(fmt.Sprintf("key%03d", rand.Intn(50))), uint64(rand.Intn(5)))
+			list = append(list, key)
+			if !seen[string(key)] {
+				seen[string(key)] = true
+				all = append(all, key)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return CompareKeys(list[i], list[j]) < 0 })
+		lists = append(lists, list)
+	}
+	sort.Slice(all, func(i, j int) bool { return CompareKeys(all[i], all[j]) < 0 })
+	require.Equal(t, all, MergeSortedKeys(lists))
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	k := func(key string, ts uint64) []byte { return KeyWithTs([]byte(key), ts) }
+	lists := [][][]byte{
+		{k("a", 2), k("a", 1), k("c", 5), k("e", 1)},
+		{k("a", 3), k("b", 1), k("c", 5), k("d", 1)},
+		{k("a", 1), k("c", 5), k("f", 1)},
+	}
+	var readers []FrameReader
+	for i, list := range lists {
+		b := NewPageBuffer(64)
+		for _, key := range list {
+			b.WriteFrame(key)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("keys%d", i))
+		require.NoError(t, ioutil.WriteFile(path, b.Bytes(), 0600))
+
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		readers = append(readers, NewFrameReader(f))
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, MergeFiles(&out, readers))
+	var got [][]byte
+	for {
+		key, err := NextFrame(&out)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, key)
+	}
+	want := [][]byte{k("a", 3), k("a", 2), k("a", 1), k("b", 1), k("c", 5), k("d", 1),
+		k("e", 1), k("f", 1)}
+	require.Equal(t, want, got)
+	require.Equal(t, MergeSortedKeys(lists), got)
+
+	out.Reset()
+	require.NoError(t, MergeFiles(&out, nil))
+	require.Zero(t, out.Len())
+}
+
+func TestMergeFilesError(t *testing.T) {
+	b := NewPageBuffer(64)
+	b.WriteFrame(KeyWithTs([]byte("a"), 1))
+	data := b.Bytes()
+	// The second reader ends within a frame.
+	readers := []FrameReader{
+		NewFrameReader(bytes.NewReader(data)),
+		NewFrameReader(bytes.NewReader(data[:len(data)-1])),
+	}
+	err := MergeFiles(ioutil.Discard, readers)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), io.ErrUnexpectedEOF.Error())
+}
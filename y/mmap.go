@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// Mmap uses the mmap system call to memory-map a file. If writable is true,
+// memory protection of the pages is set so that they may be written to as well.
+func Mmap(fd *os.File, writable bool, size int64) ([]byte, error) {
+	return z.Mmap(fd, writable, size)
+}
+
+// Munmap unmaps a previously mapped slice.
+func Munmap(b []byte) error {
+	return z.Munmap(b)
+}
+
+// ReadMmap returns the sz bytes at offset off of the memory mapped data. It returns ErrEOF if off
+// is at or beyond the end of the mapping, and ErrTruncated if the mapping ends within the range.
+// The returned slice aliases data, so it must not be used after data is unmapped.
+func ReadMmap(data []byte, off int64, sz int) ([]byte, error) {
+	if off < 0 || sz < 0 {
+		return nil, errors.Errorf("Invalid mmap read at offset: %d, size: %d", off, sz)
+	}
+	if off >= int64(len(data)) && sz > 0 || off > int64(len(data)) {
+		return nil, ErrEOF
+	}
+	if off+int64(sz) > int64(len(data)) {
+		return nil, ErrTruncated
+	}
+	return data[off : off+int64(sz)], nil
+}
+
+// ReadMmapFrame reads the frame at offset off of the memory mapped data, as written by
+// PageBuffer.WriteFrame, and returns its payload along with the offset of the next frame. It
+// returns ErrEOF if off is at or beyond the end of the mapping, and ErrTruncated if the mapping
+// ends within the frame. The returned slice aliases data.
+func ReadMmapFrame(data []byte, off int64) ([]byte, int64, error) {
+	if off < 0 {
+		return nil, 0, errors.Errorf("Invalid mmap read at offset: %d", off)
+	}
+	if off >= int64(len(data)) {
+		return nil, 0, ErrEOF
+	}
+	sz, n := binary.Uvarint(data[off:])
+	switch {
+	case n == 0:
+		return nil, 0, ErrTruncated
+	case n < 0:
+		return nil, 0, errors.Errorf("Invalid frame length at offset: %d", off)
+	case sz > uint64(len(data)):
+		// Also guards the conversion to int below.
+		return nil, 0, ErrTruncated
+	}
+	off += int64(n)
+	payload, err := ReadMmap(data, off, int(sz))
+	if err == ErrEOF {
+		// The frame header was complete, so its payload is missing.
+		err = ErrTruncated
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return payload, off + int64(sz), nil
+}
+
+// NewMmapBuffer returns a read-only PageBuffer over the size bytes at offset off of the file fd,
+// which are memory mapped rather than copied, along with a function unmapping them. The buffer is
+// frozen, so calls modifying it panic. It must not be used after the unmap function is called.
+func NewMmapBuffer(fd *os.File, off, size int64) (*PageBuffer, func() error, error) {
+	if off < 0 || size < 0 {
+		return nil, nil, errors.Errorf("Invalid mmap buffer at offset: %d, size: %d", off, size)
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, nil, Wrapf(err, "While stat-ing file: %s", fd.Name())
+	}
+	if off+size > fi.Size() {
+		// Accessing a mapping beyond the end of the file faults.
+		return nil, nil, ErrTruncated
+	}
+
+	b := &PageBuffer{frozen: true}
+	if size == 0 {
+		return b, func() error { return nil }, nil
+	}
+	// Mappings start at the beginning of the file, so the buffer is placed at off within it.
+	data, err := Mmap(fd, false, off+size)
+	if err != nil {
+		return nil, nil, Wrapf(err, "While mmapping file: %s with size: %d", fd.Name(), off+size)
+	}
+	b.pages = []*page{{buf: data[off : off+size : off+size]}}
+	b.length = int(size)
+	return b, func() error { return Munmap(data) }, nil
+}
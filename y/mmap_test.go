@@ -0,0 +1,94 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMmap(t *testing.T) {
+	f, err := ioutil.TempFile("", "badger-test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	data := []byte("0123456789abcdef")
+	_, err = f.Write(data)
+	require.NoError(t, err)
+
+	mmap, err := Mmap(f, false, int64(len(data)))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, Munmap(mmap)) }()
+
+	buf, err := ReadMmap(mmap, 4, 6)
+	require.NoError(t, err)
+	require.Equal(t, []byte("456789"), buf)
+
+	// Reading exactly up to the end is fine.
+	buf, err = ReadMmap(mmap, 10, 6)
+	require.NoError(t, err)
+	require.Equal(t, []byte("abcdef"), buf)
+
+	// A read starting within the mapping and ending past it is truncated, while one starting at
+	// the end is a clean EOF.
+	_, err = ReadMmap(mmap, 10, 7)
+	require.Equal(t, ErrTruncated, err)
+	_, err = ReadMmap(mmap, int64(len(data)), 1)
+	require.Equal(t, ErrEOF, err)
+	buf, err = ReadMmap(mmap, int64(len(data)), 0)
+	require.NoError(t, err)
+	require.Empty(t, buf)
+	_, err = ReadMmap(mmap, int64(len(data))+1, 0)
+	require.Equal(t, ErrEOF, err)
+	_, err = ReadMmap(mmap, -1, 2)
+	require.Error(t, err)
+}
+
+func TestReadMmapFrame(t *testing.T) {
+	b := NewPageBuffer(32)
+	b.WriteFrame([]byte("foo"))
+	b.WriteFrame(nil)
+	b.WriteFrame(make([]byte, 300))
+	data := b.Bytes()
+
+	payload, off, err := ReadMmapFrame(data, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), payload)
+	payload, off, err = ReadMmapFrame(data, off)
+	require.NoError(t, err)
+	require.Empty(t, payload)
+	payload, off, err = ReadMmapFrame(data, off)
+	require.NoError(t, err)
+	require.Len(t, payload, 300)
+	require.Equal(t, int64(len(data)), off)
+
+	// A clean end of the data.
+	_, _, err = ReadMmapFrame(data, off)
+	require.Equal(t, ErrEOF, err)
+
+	// Records cut short, within the payload, right after the header, and within the header.
+	for _, end := range []int{len(data) - 1, 7, 6} {
+		_, _, err = ReadMmapFrame(data[:end], 5)
+		require.Equal(t, ErrTruncated, err, "end: %d", end)
+	}
+	_, _, err = ReadMmapFrame([]byte{0x80, 0x80}, 0)
+	require.Equal(t, ErrTruncated, err)
+}
@@ -0,0 +1,70 @@
+// +build !windows,!plan9
+
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMmapBuffer(t *testing.T) {
+	f, err := ioutil.TempFile("", "badger-test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	data := make([]byte, 3*os.Getpagesize())
+	rand.Read(data)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+
+	// An offset which isn't page aligned.
+	off, size := int64(100), int64(len(data)-200)
+	b, unmap, err := NewMmapBuffer(f, off, size)
+	require.NoError(t, err)
+	require.Equal(t, int(size), b.Len())
+	require.Equal(t, data[off:off+size], b.Bytes())
+
+	p := make([]byte, 50)
+	n, err := b.ReadAt(p, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 50, n)
+	require.Equal(t, data[off+1000:off+1050], p)
+
+	got, err := ioutil.ReadAll(b.NewReaderAt(0))
+	require.NoError(t, err)
+	require.Equal(t, data[off:off+size], got)
+
+	require.PanicsWithValue(t, ErrPageBufferFrozen, func() { b.Write([]byte("foo")) })
+	require.NoError(t, unmap())
+
+	b, unmap, err = NewMmapBuffer(f, 10, 0)
+	require.NoError(t, err)
+	require.Zero(t, b.Len())
+	require.NoError(t, unmap())
+
+	_, _, err = NewMmapBuffer(f, off, int64(len(data)))
+	require.Equal(t, ErrTruncated, err)
+	_, _, err = NewMmapBuffer(f, -1, 10)
+	require.Error(t, err)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// PackedUints is an array of unsigned integers, each stored in just the bits needed for the
+// largest value it can hold, e.g. 17 bits per value for offsets up to 100000. Its functions are
+// not thread safe.
+type PackedUints struct {
+	width uint // Bits per value.
+	n     int  // Number of values.
+	words []uint64
+}
+
+// NewPackedUints returns a new, empty PackedUints which can hold values up to maxValue.
+func NewPackedUints(maxValue uint64) *PackedUints {
+	return &PackedUints{width: uint(bits.Len64(maxValue))}
+}
+
+// Width returns the number of bits used per value.
+func (p *PackedUints) Width() int {
+	return int(p.width)
+}
+
+// Len returns the number of values in the array.
+func (p *PackedUints) Len() int {
+	return p.n
+}
+
+// Append appends v to the array. v must not be larger than the maxValue the array was created
+// with.
+func (p *PackedUints) Append(v uint64) {
+	AssertTruef(p.width == 64 || v>>p.width == 0,
+		"Value %d doesn't fit in %d bits of PackedUints", v, p.width)
+	bit := uint64(p.n) * uint64(p.width)
+	p.n++
+	for uint64(len(p.words))*64 < bit+uint64(p.width) {
+		p.words = append(p.words, 0)
+	}
+	if p.width == 0 {
+		return
+	}
+	idx, off := bit/64, uint(bit%64)
+	p.words[idx] |= v << off
+	if off+p.width > 64 {
+		// The value continues in the next word.
+		p.words[idx+1] |= v >> (64 - off)
+	}
+}
+
+// Get returns the value at index i.
+func (p *PackedUints) Get(i int) uint64 {
+	AssertTruef(i >= 0 && i < p.n, "Index %d out of range of PackedUints of length %d", i, p.n)
+	if p.width == 0 {
+		return 0
+	}
+	bit := uint64(i) * uint64(p.width)
+	idx, off := bit/64, uint(bit%64)
+	v := p.words[idx] >> off
+	if off+p.width > 64 {
+		v |= p.words[idx+1] << (64 - off)
+	}
+	if p.width < 64 {
+		v &= 1<<p.width - 1
+	}
+	return v
+}
+
+// Encode returns the encoded array, which can be decoded by DecodePackedUints. It consists of a
+// byte holding the width, the number of values as a varint, and the packed values.
+func (p *PackedUints) Encode() []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen64+8*len(p.words))
+	buf[0] = byte(p.width)
+	sz := 1 + binary.PutUvarint(buf[1:], uint64(p.n))
+	for _, w := range p.words {
+		binary.BigEndian.PutUint64(buf[sz:], w)
+		sz += 8
+	}
+	return buf[:sz]
+}
+
+// DecodePackedUints decodes an array encoded by PackedUints.Encode.
+func DecodePackedUints(data []byte) (*PackedUints, error) {
+	if len(data) < 2 || data[0] > 64 {
+		return nil, errors.New("Invalid PackedUints header")
+	}
+	p := &PackedUints{width: uint(data[0])}
+	n, sz := binary.Uvarint(data[1:])
+	if sz <= 0 || n > math.MaxInt32 {
+		return nil, errors.New("Invalid PackedUints length")
+	}
+	data = data[1+sz:]
+	if numWords := (n*uint64(p.width) + 63) / 64; uint64(len(data)) != numWords*8 {
+		return nil, errors.Errorf("PackedUints of %d values of %d bits can't have %d bytes",
+			n, p.width, len(data))
+	}
+	p.n = int(n)
+	p.words = make([]uint64, len(data)/8)
+	for i := range p.words {
+		p.words[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+	return p, nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackedUints(t *testing.T) {
+	for _, maxValue := range []uint64{0, 1, 100, 1<<7 - 1, 1 << 20, 1<<33 - 1, math.MaxUint64} {
+		p := NewPackedUints(maxValue)
+		var vals []uint64
+		for i := 0; i < 1000; i++ {
+			v := rand.Uint64()
+			if maxValue < math.MaxUint64 {
+				v %= maxValue + 1
+			}
+			if i == 0 {
+				v = maxValue
+			}
+			vals = append(vals, v)
+			p.Append(v)
+		}
+		require.Equal(t, len(vals), p.Len())
+		for i, v := range vals {
+			require.Equal(t, v, p.Get(i), "max: %d index: %d", maxValue, i)
+		}
+
+		d, err := DecodePackedUints(p.Encode())
+		require.NoError(t, err)
+		require.Equal(t, p.Width(), d.Width())
+		require.Equal(t, len(vals), d.Len())
+		for i, v := range vals {
+			require.Equal(t, v, d.Get(i), "max: %d index: %d", maxValue, i)
+		}
+	}
+}
+
+func TestPackedUintsWidth(t *testing.T) {
+	for maxValue, width := range map[uint64]int{
+		0: 0, 1: 1, 127: 7, 128: 8, 1<<33 - 1: 33, 1 << 33: 34, math.MaxUint64: 64,
+	} {
+		require.Equal(t, width, NewPackedUints(maxValue).Width(), "max: %d", maxValue)
+	}
+
+	// Values are packed, e.g. 10 values of 7 bits fit in 2 words.
+	p := NewPackedUints(127)
+	for i := 0; i < 10; i++ {
+		p.Append(uint64(i))
+	}
+	require.Len(t, p.words, 2)
+	require.Equal(t, 1+1+16, len(p.Encode()))
+}
+
+func TestDecodePackedUintsInvalid(t *testing.T) {
+	p := NewPackedUints(1000)
+	p.Append(42)
+	data := p.Encode()
+	for _, invalid := range [][]byte{nil, {65, 0}, {10, 0x80}, data[:len(data)-1],
+		append(data, 0)} {
+		_, err := DecodePackedUints(invalid)
+		require.Error(t, err, "data: %x", invalid)
+	}
+
+	d, err := DecodePackedUints(NewPackedUints(5).Encode())
+	require.NoError(t, err)
+	require.Zero(t, d.Len())
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// PrefixDeltaWriter writes a sequence of keys using front coding: each key is written as the length
+// of the prefix it shares with the previous key, the length of the rest of it, and the rest of it,
+// with both lengths in varint encoding. It works best with sorted keys, which tend to share long
+// prefixes. The keys can be read back using a PrefixDeltaReader.
+type PrefixDeltaWriter struct {
+	w    io.Writer
+	prev []byte
+	buf  []byte
+}
+
+// NewPrefixDeltaWriter returns a new PrefixDeltaWriter writing to w.
+func NewPrefixDeltaWriter(w io.Writer) *PrefixDeltaWriter {
+	return &PrefixDeltaWriter{w: w}
+}
+
+// Add writes key to the underlying writer. key isn't retained, so it can be modified afterwards.
+func (pw *PrefixDeltaWriter) Add(key []byte) error {
+	shared := 0
+	for shared < len(key) && shared < len(pw.prev) && key[shared] == pw.prev[shared] {
+		shared++
+	}
+	var hdr [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(shared))
+	n += binary.PutUvarint(hdr[n:], uint64(len(key)-shared))
+
+	pw.buf = append(append(pw.buf[:0], hdr[:n]...), key[shared:]...)
+	if _, err := pw.w.Write(pw.buf); err != nil {
+		return err
+	}
+	pw.prev = append(pw.prev[:0], key...)
+	return nil
+}
+
+// PrefixDeltaReader reads the keys written by a PrefixDeltaWriter.
+type PrefixDeltaReader struct {
+	r    *bufio.Reader
+	prev []byte
+}
+
+// NewPrefixDeltaReader returns a new PrefixDeltaReader reading from r. It buffers reads from r, so
+// r must not be read from directly afterwards.
+func NewPrefixDeltaReader(r io.Reader) *PrefixDeltaReader {
+	return &PrefixDeltaReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next key. It returns io.EOF if there are no more keys, and io.ErrUnexpectedEOF
+// if the data ends within a key. It returns an error for suffixes longer than maxFrameSize, which
+// can only come from corrupt data. The returned key isn't modified by later calls.
+func (pr *PrefixDeltaReader) Next() ([]byte, error) {
+	shared, _, err := ReadUvarint(pr.r)
+	if err != nil {
+		return nil, err
+	}
+	suffix, _, err := ReadUvarint(pr.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if shared > uint64(len(pr.prev)) {
+		return nil, errors.Errorf("Shared prefix length: %d exceeds previous key length: %d",
+			shared, len(pr.prev))
+	}
+	if suffix > maxFrameSize {
+		return nil, errors.Errorf("Key suffix length: %d exceeds the limit: %d", suffix, maxFrameSize)
+	}
+
+	key := append(make([]byte, 0, shared), pr.prev[:shared]...)
+	if key, err = readBounded(key, pr.r, int(suffix)); err != nil {
+		return nil, err
+	}
+	pr.prev = key
+	return key, nil
+}
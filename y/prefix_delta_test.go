@@ -0,0 +1,126 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixDelta(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	keys := [][]byte{
+		[]byte(""),
+		[]byte("a"),
+		[]byte("abc"),
+		[]byte("abd"),
+		[]byte(long + "1"),
+		[]byte(long + "2"),
+		[]byte(long + "2"), // Same as the previous key.
+		[]byte(long + "2suffix"),
+		[]byte("zzz"), // No shared prefix.
+		KeyWithTs([]byte("zzz"), 10),
+	}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%05d", i*37)))
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	var buf bytes.Buffer
+	w := NewPrefixDeltaWriter(&buf)
+	var raw int
+	for _, key := range keys {
+		require.NoError(t, w.Add(key))
+		raw += len(key)
+	}
+	require.True(t, buf.Len() < raw, "encoded: %d, raw: %d", buf.Len(), raw)
+
+	r := NewPrefixDeltaReader(&buf)
+	var got [][]byte
+	for {
+		key, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, key)
+	}
+	require.Equal(t, keys, got)
+}
+
+func TestPrefixDeltaEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPrefixDeltaWriter(&buf)
+	require.NoError(t, w.Add([]byte("abc")))
+	require.NoError(t, w.Add([]byte("abxy")))
+	require.NoError(t, w.Add([]byte("b")))
+	require.Equal(t, []byte("\x00\x03abc\x02\x02xy\x00\x01b"), buf.Bytes())
+
+	// Invalid data.
+	for _, data := range []string{"\x00\x03ab", "\x00", "\x01\x01a", "\x00\x01a\x02\x00"} {
+		r := NewPrefixDeltaReader(strings.NewReader(data))
+		var err error
+		for err == nil {
+			_, err = r.Next()
+		}
+		require.NotEqual(t, io.EOF, err, "data: %q", data)
+	}
+}
+
+func TestPrefixDeltaSuffixLength(t *testing.T) {
+	r := NewPrefixDeltaReader(bytes.NewReader([]byte("\x00\xff\xff\xff\xff\x0f")))
+	_, err := r.Next()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exceeds the limit")
+
+	// A plausible length with little data behind it fails without allocating the whole key.
+	var buf bytes.Buffer
+	w := NewPrefixDeltaWriter(&buf)
+	require.NoError(t, w.Add([]byte("abc")))
+	buf.Write([]byte("\x02\x80\x80\x80\x02xyz")) // Suffix length of 1<<28.
+	r = NewPrefixDeltaReader(&buf)
+	key, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, []byte("abc"), key)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = r.Next()
+	runtime.ReadMemStats(&after)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20,
+		"allocated: %d", after.TotalAlloc-before.TotalAlloc)
+
+	// Suffixes longer than the read chunk size are read in full.
+	long := bytes.Repeat([]byte("k"), 3*readChunkSize+1)
+	buf.Reset()
+	w = NewPrefixDeltaWriter(&buf)
+	require.NoError(t, w.Add([]byte("k")))
+	require.NoError(t, w.Add(long))
+	r = NewPrefixDeltaReader(&buf)
+	_, err = r.Next()
+	require.NoError(t, err)
+	key, err = r.Next()
+	require.NoError(t, err)
+	require.Equal(t, long, key)
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"sort"
+	"sync"
+)
+
+// quantilesCentroid is a cluster of values of Quantiles, summarized by their mean.
+type quantilesCentroid struct {
+	mean   float64
+	weight float64
+}
+
+// Quantiles estimates quantiles of a stream of float64 values, like a t-digest. Values are
+// clustered into centroids, which are kept small near the tails of the distribution and allowed
+// to grow towards the median, so that extreme quantiles stay accurate. Its memory is bounded by
+// the compression it's created with, growing only logarithmically with the number of values. It's
+// safe for concurrent use.
+type Quantiles struct {
+	sync.Mutex
+	compression float64
+	centroids   []quantilesCentroid // Sorted by mean.
+	buf         []quantilesCentroid // Values which aren't merged into centroids yet.
+	count       float64
+	min         float64
+	max         float64
+}
+
+// NewQuantiles returns a new, empty Quantiles. A larger compression, e.g. 100, gives more accurate
+// quantiles at the cost of more memory, as the number of centroids is proportional to it.
+func NewQuantiles(compression float64) *Quantiles {
+	AssertTruef(compression >= 1, "Quantiles compression must be at least 1, got: %v", compression)
+	return &Quantiles{compression: compression}
+}
+
+// Add adds v to the values.
+func (q *Quantiles) Add(v float64) {
+	q.Lock()
+	defer q.Unlock()
+	if q.count == 0 || v < q.min {
+		q.min = v
+	}
+	if q.count == 0 || v > q.max {
+		q.max = v
+	}
+	q.count++
+	q.buf = append(q.buf, quantilesCentroid{mean: v, weight: 1})
+	if float64(len(q.buf)) >= 4*q.compression {
+		q.merge()
+	}
+}
+
+// merge merges the buffered values into the centroids.
+func (q *Quantiles) merge() {
+	if len(q.buf) == 0 {
+		return
+	}
+	all := append(q.centroids, q.buf...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]quantilesCentroid, 0, len(q.centroids)+1)
+	cur := all[0]
+	var cum float64 // Weight of the centroids before cur.
+	for _, c := range all[1:] {
+		weight := cur.weight + c.weight
+		// The size limit of a centroid around quantile k is proportional to k*(1-k).
+		k := (cum + weight/2) / q.count
+		if weight <= 4*q.count*k*(1-k)/q.compression {
+			cur.mean += (c.mean - cur.mean) * c.weight / weight
+			cur.weight = weight
+			continue
+		}
+		merged = append(merged, cur)
+		cum += cur.weight
+		cur = c
+	}
+	q.centroids = append(merged, cur)
+	q.buf = q.buf[:0]
+}
+
+// Quantile returns the estimated value below which a fraction k of the values fall, with k in
+// [0, 1]. It interpolates linearly between the means of the centroids around the quantile. It
+// returns 0 if no values have been added.
+func (q *Quantiles) Quantile(k float64) float64 {
+	q.Lock()
+	defer q.Unlock()
+	if q.count == 0 {
+		return 0
+	}
+	if k <= 0 {
+		return q.min
+	}
+	if k >= 1 {
+		return q.max
+	}
+	q.merge()
+
+	// The values of a centroid are assumed to be spread around its mean, which is at the rank
+	// halfway through it. Before the first and after the last centroid, interpolate with min and
+	// max respectively.
+	rank := k * q.count
+	prevRank, prevMean := 0.0, q.min
+	var cum float64
+	for _, c := range q.centroids {
+		center := cum + c.weight/2
+		if rank < center {
+			return interpolate(rank, prevRank, center, prevMean, c.mean)
+		}
+		prevRank, prevMean = center, c.mean
+		cum += c.weight
+	}
+	return interpolate(rank, prevRank, q.count, prevMean, q.max)
+}
+
+// interpolate returns the value at x on the line from (x0, y0) to (x1, y1).
+func interpolate(x, x0, x1, y0, y1 float64) float64 {
+	if x1 <= x0 {
+		return y0
+	}
+	return y0 + (y1-y0)*(x-x0)/(x1-x0)
+}
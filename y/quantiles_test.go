@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantiles(t *testing.T) {
+	q := NewQuantiles(100)
+	require.Zero(t, q.Quantile(0.5))
+
+	r := rand.New(rand.NewSource(1))
+	const n = 100000
+	values := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		// A skewed distribution, like table sizes.
+		v := math.Exp(r.NormFloat64())
+		values = append(values, v)
+		q.Add(v)
+	}
+	sort.Float64s(values)
+
+	require.Equal(t, values[0], q.Quantile(0))
+	require.Equal(t, values[n-1], q.Quantile(1))
+	for _, k := range []float64{0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999} {
+		// The estimate must fall within 0.5% of the quantile in rank.
+		got := q.Quantile(k)
+		rank := float64(sort.SearchFloat64s(values, got)) / n
+		require.InDelta(t, k, rank, 0.005, "quantile: %v, got: %v", k, got)
+	}
+	// Memory is bounded.
+	require.True(t, len(q.centroids) < 1000, "centroids: %d", len(q.centroids))
+	require.True(t, len(q.buf) < 400)
+}
+
+func TestQuantilesUniform(t *testing.T) {
+	q := NewQuantiles(50)
+	for i := 0; i < 10000; i++ {
+		q.Add(float64(rand.Intn(1000)))
+	}
+	for _, k := range []float64{0.1, 0.5, 0.9} {
+		require.InDelta(t, 1000*k, q.Quantile(k), 20, "quantile: %v", k)
+	}
+
+	single := NewQuantiles(10)
+	single.Add(7)
+	for _, k := range []float64{0, 0.5, 1} {
+		require.Equal(t, 7.0, single.Quantile(k))
+	}
+}
+
+func TestQuantilesConcurrent(t *testing.T) {
+	q := NewQuantiles(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				q.Add(float64(j))
+				q.Quantile(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	require.InDelta(t, 500, q.Quantile(0.5), 20)
+}
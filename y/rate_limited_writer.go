@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimitedWriter is an io.Writer which limits the rate of writes to the underlying writer,
+// using a token bucket holding up to one second worth of bytes. It's safe for concurrent use.
+type RateLimitedWriter struct {
+	w io.Writer
+
+	mu     sync.Mutex
+	rate   int64     // Bytes per second. Non-positive means unlimited.
+	tokens float64   // Bytes which can be written right away. Negative if reserved by waiters.
+	last   time.Time // Last time tokens were refilled.
+}
+
+// NewRateLimitedWriter returns a new RateLimitedWriter writing to w at up to bytesPerSec bytes per
+// second. A non-positive bytesPerSec disables rate limiting.
+func NewRateLimitedWriter(w io.Writer, bytesPerSec int64) *RateLimitedWriter {
+	return &RateLimitedWriter{w: w, rate: bytesPerSec, last: time.Now()}
+}
+
+// SetRate changes the rate limit to bytesPerSec bytes per second. It applies to writes which
+// haven't started waiting yet.
+func (rw *RateLimitedWriter) SetRate(bytesPerSec int64) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.refill(time.Now())
+	rw.rate = bytesPerSec
+}
+
+// refill adds the tokens accumulated since the last refill. It must be called with mu held.
+func (rw *RateLimitedWriter) refill(now time.Time) {
+	if rw.rate > 0 {
+		rw.tokens += now.Sub(rw.last).Seconds() * float64(rw.rate)
+		if rw.tokens > float64(rw.rate) {
+			rw.tokens = float64(rw.rate)
+		}
+	}
+	rw.last = now
+}
+
+// reserve takes tokens for writing up to n bytes from the bucket. It returns the number of bytes
+// which may be written, which is capped to one second worth of bytes, and how long to wait before
+// writing them.
+func (rw *RateLimitedWriter) reserve(n int) (int, time.Duration) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.rate <= 0 {
+		return n, 0
+	}
+	if int64(n) > rw.rate {
+		n = int(rw.rate)
+	}
+	rw.refill(time.Now())
+	rw.tokens -= float64(n)
+	if rw.tokens >= 0 {
+		return n, 0
+	}
+	return n, time.Duration(-rw.tokens / float64(rw.rate) * float64(time.Second))
+}
+
+// Write writes p to the underlying writer, blocking as needed to stay within the rate limit.
+// Large writes are split in chunks of up to one second worth of bytes.
+func (rw *RateLimitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		sz, wait := rw.reserve(len(p) - written)
+		time.Sleep(wait)
+		n, err := rw.w.Write(p[written : written+sz])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
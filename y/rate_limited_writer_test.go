@@ -0,0 +1,56 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedWriter(t *testing.T) {
+	data := make([]byte, 30<<10)
+
+	var buf bytes.Buffer
+	rw := NewRateLimitedWriter(&buf, 100<<10)
+	start := time.Now()
+	for i := 0; i < len(data); i += 1 << 10 {
+		n, err := rw.Write(data[i : i+1<<10])
+		require.NoError(t, err)
+		require.Equal(t, 1<<10, n)
+	}
+	// 30 KiB at 100 KiB/s takes at least 300ms.
+	require.True(t, time.Since(start) >= 290*time.Millisecond, "took: %s", time.Since(start))
+	require.Equal(t, len(data), buf.Len())
+
+	// A single write larger than the rate is split.
+	rw.SetRate(20 << 10)
+	start = time.Now()
+	n, err := rw.Write(data)
+	require.NoError(t, err)
+	require.Equal(t, len(data), n)
+	require.True(t, time.Since(start) >= 1400*time.Millisecond, "took: %s", time.Since(start))
+
+	// Unlimited.
+	rw.SetRate(0)
+	start = time.Now()
+	_, err = rw.Write(data)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 100*time.Millisecond, "took: %s", time.Since(start))
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Retry calls fn until it succeeds, up to attempts times. It waits between attempts with
+// exponential backoff starting at base, with jitter. It returns nil on success, and the error of
+// the last attempt otherwise. attempts below 1 are treated as 1, so that fn is called. If ctx is
+// done before fn succeeds, Retry stops early and returns the last error of fn, or ctx.Err() if fn
+// wasn't called yet.
+func Retry(ctx context.Context, attempts int, base time.Duration, fn func() error) error {
+	return RetryIf(ctx, attempts, base, nil, fn)
+}
+
+// RetryIf is Retry, but it gives up as soon as fn returns an error for which retriable returns
+// false, returning that error. A nil retriable means all errors are retried.
+func RetryIf(ctx context.Context, attempts int, base time.Duration,
+	retriable func(err error) bool, fn func() error) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if retriable != nil && !retriable(err) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+
+		timer := time.NewTimer(backoff(base, i))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+	return err
+}
+
+// backoff returns the duration to wait after the given failed attempt. It's picked uniformly from
+// [d/2, d), where d doubles with every attempt starting from base.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
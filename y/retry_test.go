@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+
+	t.Run("eventual success", func(t *testing.T) {
+		var calls int
+		err := Retry(context.Background(), 5, time.Millisecond, func() error {
+			calls++
+			if calls < 3 {
+				return errTransient
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("exhausted attempts", func(t *testing.T) {
+		var calls int
+		err := Retry(context.Background(), 4, time.Millisecond, func() error {
+			calls++
+			return errTransient
+		})
+		require.Equal(t, errTransient, err)
+		require.Equal(t, 4, calls)
+	})
+
+	t.Run("non-positive attempts", func(t *testing.T) {
+		for _, attempts := range []int{0, -1} {
+			var calls int
+			err := Retry(context.Background(), attempts, time.Millisecond, func() error {
+				calls++
+				return errTransient
+			})
+			require.Equal(t, errTransient, err, "attempts: %d", attempts)
+			require.Equal(t, 1, calls, "attempts: %d", attempts)
+		}
+	})
+
+	t.Run("non-retriable", func(t *testing.T) {
+		var calls int
+		retriable := func(err error) bool { return err == errTransient }
+		err := RetryIf(context.Background(), 5, time.Millisecond, retriable, func() error {
+			calls++
+			if calls == 2 {
+				return errPermanent
+			}
+			return errTransient
+		})
+		require.Equal(t, errPermanent, err)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int
+		start := time.Now()
+		err := Retry(ctx, 5, time.Hour, func() error {
+			calls++
+			cancel()
+			return errTransient
+		})
+		require.Equal(t, errTransient, err)
+		require.Equal(t, 1, calls)
+		require.True(t, time.Since(start) < time.Minute)
+
+		require.Equal(t, context.Canceled, Retry(ctx, 5, time.Millisecond, func() error {
+			t.Fatal("fn should not be called with a done context")
+			return nil
+		}))
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	base := 10 * time.Millisecond
+	for i := 0; i < 5; i++ {
+		d := backoff(base, i)
+		max := base << uint(i)
+		require.True(t, d >= max/2 && d < max, "attempt: %d, backoff: %s", i, d)
+	}
+	require.True(t, backoff(base, 100) > 0)
+	require.True(t, backoff(time.Hour, 100) > 0)
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+// RingBuffer is a fixed capacity buffer. Once it's full, writing to it overwrites the oldest data,
+// so its memory usage never grows. Its functions are not thread safe.
+type RingBuffer struct {
+	buf    []byte
+	head   int // Idx of the oldest byte in buf.
+	length int // Length of data in buf.
+}
+
+// NewRingBuffer returns a new RingBuffer which holds up to capacity bytes.
+func NewRingBuffer(capacity int) *RingBuffer {
+	return &RingBuffer{buf: make([]byte, capacity)}
+}
+
+// Write writes data to RingBuffer r, dropping the oldest bytes if r overflows. It always writes
+// len(data) bytes and returns a nil error.
+func (r *RingBuffer) Write(data []byte) (int, error) {
+	dataLen := len(data)
+	if dataLen >= len(r.buf) {
+		// Only the last len(r.buf) bytes of data would survive.
+		copy(r.buf, data[dataLen-len(r.buf):])
+		r.head, r.length = 0, len(r.buf)
+		return dataLen, nil
+	}
+
+	tail := (r.head + r.length) % len(r.buf)
+	n := copy(r.buf[tail:], data)
+	copy(r.buf, data[n:])
+
+	r.length += dataLen
+	if r.length > len(r.buf) {
+		r.head = (r.head + r.length - len(r.buf)) % len(r.buf)
+		r.length = len(r.buf)
+	}
+	return dataLen, nil
+}
+
+// Len returns length of RingBuffer. It never exceeds Cap.
+func (r *RingBuffer) Len() int {
+	return r.length
+}
+
+// Cap returns the capacity of RingBuffer.
+func (r *RingBuffer) Cap() int {
+	return len(r.buf)
+}
+
+// Bytes returns the data held by RingBuffer, oldest first, as single []byte.
+func (r *RingBuffer) Bytes() []byte {
+	buf := make([]byte, r.length)
+	end := r.head + r.length
+	if end <= len(r.buf) {
+		copy(buf, r.buf[r.head:end])
+		return buf
+	}
+	// Data wraps around the end of r.buf.
+	n := copy(buf, r.buf[r.head:])
+	copy(buf[n:], r.buf[:end-len(r.buf)])
+	return buf
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := NewRingBuffer(10)
+	require.Zero(t, r.Len())
+	require.Empty(t, r.Bytes())
+
+	n, err := r.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, []byte("abcdef"), r.Bytes())
+
+	// This write wraps around, dropping "abc".
+	r.Write([]byte("ghijklm"))
+	require.Equal(t, 10, r.Len())
+	require.Equal(t, []byte("defghijklm"), r.Bytes())
+
+	r.Write([]byte("n"))
+	require.Equal(t, []byte("efghijklmn"), r.Bytes())
+
+	// A write larger than the capacity keeps only its tail.
+	r.Write([]byte("0123456789ABC"))
+	require.Equal(t, 10, r.Len())
+	require.Equal(t, []byte("3456789ABC"), r.Bytes())
+}
+
+func TestRingBufferRandomWrites(t *testing.T) {
+	var wb [4096]byte
+	rand.Read(wb[:])
+
+	r := NewRingBuffer(100)
+	var all []byte
+	for off := 0; off < len(wb); {
+		sz := rand.Intn(150)
+		if off+sz > len(wb) {
+			sz = len(wb) - off
+		}
+		r.Write(wb[off : off+sz])
+		all = append(all, wb[off:off+sz]...)
+		off += sz
+
+		want := all
+		if len(want) > r.Cap() {
+			want = want[len(want)-r.Cap():]
+		}
+		require.Equal(t, len(want), r.Len())
+		require.True(t, bytes.Equal(want, r.Bytes()))
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SegmentWriter is an append-only log split into segment files of bounded size, like the value
+// log. Each record is written as a frame, i.e. prefixed by its length in varint encoding, and is
+// addressed by its segment ID and offset. It's safe for concurrent use.
+type SegmentWriter struct {
+	sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64
+	sync    bool
+
+	fd     *os.File // Current segment. Nil until the first Append.
+	segID  uint32
+	offset int64 // Size of the current segment.
+}
+
+// NewSegmentWriter returns a new SegmentWriter writing segment files named prefix followed by the
+// segment ID to dir. It moves on to a new segment once appending a record would grow the current
+// one beyond maxSize, so only records larger than maxSize end up in segments larger than that.
+// If sync is true, records are written with O_DSYNC. Segments are created on demand, and it's an
+// error if a segment file already exists.
+func NewSegmentWriter(dir, prefix string, maxSize int64, sync bool) *SegmentWriter {
+	return &SegmentWriter{dir: dir, prefix: prefix, maxSize: maxSize, sync: sync}
+}
+
+// SegmentPath returns the path of the segment file with ID segmentID.
+func (w *SegmentWriter) SegmentPath(segmentID uint32) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s%06d", w.prefix, segmentID))
+}
+
+// Append appends data as a new record. It returns the ID of the segment the record was written to,
+// and its offset in that segment.
+func (w *SegmentWriter) Append(data []byte) (uint32, int64, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	var hdr [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(hdr[:], uint64(len(data)))
+	recSize := int64(n + len(data))
+
+	switch {
+	case w.fd == nil:
+		if err := w.open(0); err != nil {
+			return 0, 0, err
+		}
+	case w.offset > 0 && w.offset+recSize > w.maxSize:
+		if err := w.rotate(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	offset := w.offset
+	if _, err := w.fd.Write(append(hdr[:n], data...)); err != nil {
+		return 0, 0, Wrapf(err, "While writing to segment: %s.", w.fd.Name())
+	}
+	w.offset += recSize
+	return w.segID, offset, nil
+}
+
+// open creates the segment file with ID segID, and makes it the current segment.
+func (w *SegmentWriter) open(segID uint32) error {
+	path := w.SegmentPath(segID)
+	fd, err := CreateSyncedFile(path, w.sync)
+	if err != nil {
+		return Wrapf(err, "While creating segment: %s.", path)
+	}
+	if w.sync {
+		if err := SyncDir(w.dir); err != nil {
+			fd.Close()
+			return err
+		}
+	}
+	w.fd, w.segID, w.offset = fd, segID, 0
+	return nil
+}
+
+// rotate syncs and closes the current segment, and moves on to the next one.
+func (w *SegmentWriter) rotate() error {
+	if err := w.closeSegment(); err != nil {
+		return err
+	}
+	return w.open(w.segID + 1)
+}
+
+func (w *SegmentWriter) closeSegment() error {
+	fd := w.fd
+	w.fd = nil
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		return Wrapf(err, "While syncing segment: %s.", fd.Name())
+	}
+	return Wrapf(fd.Close(), "While closing segment: %s.", fd.Name())
+}
+
+// Read returns the record at offset in the segment with ID segmentID, as returned by Append.
+func (w *SegmentWriter) Read(segmentID uint32, offset int64) ([]byte, error) {
+	path := w.SegmentPath(segmentID)
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, Wrapf(err, "While opening segment: %s.", path)
+	}
+	defer fd.Close()
+	r := bufio.NewReader(io.NewSectionReader(fd, offset, math.MaxInt64-offset))
+	data, err := NextFrame(r)
+	return data, Wrapf(err, "While reading segment: %s at offset: %d.", path, offset)
+}
+
+// Close syncs and closes the current segment. The SegmentWriter must not be appended to afterwards.
+func (w *SegmentWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if w.fd == nil {
+		return nil
+	}
+	return w.closeSegment()
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w := NewSegmentWriter(dir, "seg", 1000, false)
+	type loc struct {
+		seg uint32
+		off int64
+	}
+	locs := make(map[loc][]byte)
+	var lastSeg uint32
+	for i := 0; i < 200; i++ {
+		data := []byte(fmt.Sprintf("record-%d-%s", i, make([]byte, i%50)))
+		seg, off, err := w.Append(data)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, seg, lastSeg)
+		lastSeg = seg
+		locs[loc{seg, off}] = data
+	}
+	// A record larger than maxSize gets a segment of its own.
+	big := make([]byte, 2000)
+	seg, off, err := w.Append(big)
+	require.NoError(t, err)
+	require.Equal(t, lastSeg+1, seg)
+	require.Equal(t, int64(0), off)
+	locs[loc{seg, off}] = big
+	seg, off, err = w.Append([]byte("after"))
+	require.NoError(t, err)
+	require.Equal(t, lastSeg+2, seg)
+	require.Equal(t, int64(0), off)
+	locs[loc{seg, off}] = []byte("after")
+
+	require.Greater(t, lastSeg, uint32(5))
+	for l, data := range locs {
+		got, err := w.Read(l.seg, l.off)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+	require.NoError(t, w.Close())
+
+	// Segments don't grow beyond maxSize, except for the big record.
+	for i := uint32(0); i <= lastSeg+2; i++ {
+		fi, err := os.Stat(w.SegmentPath(i))
+		require.NoError(t, err)
+		if i != lastSeg+1 {
+			require.LessOrEqual(t, fi.Size(), int64(1000))
+		}
+	}
+
+	// Records can be read after the writer is closed.
+	got, err := w.Read(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("record-0-"), got)
+	_, err = w.Read(lastSeg+3, 0)
+	require.Error(t, err)
+
+	// Existing segments are never overwritten.
+	_, _, err = NewSegmentWriter(dir, "seg", 1000, true).Append([]byte("foo"))
+	require.Error(t, err)
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// SpillBuffer is a buffer which keeps up to memLimit bytes in memory, and moves its data to a
+// temporary file once it grows beyond that. Its functions are not thread safe.
+type SpillBuffer struct {
+	memLimit int
+	dir      string
+	mem      []byte
+
+	// Set once the buffer has spilled to disk.
+	fd     *os.File
+	writer *bufio.Writer
+	size   int
+}
+
+// NewSpillBuffer returns a new SpillBuffer which spills to a temporary file in dir once it holds
+// more than memLimit bytes. Close must be called to remove the temporary file.
+func NewSpillBuffer(memLimit int, dir string) (*SpillBuffer, error) {
+	if memLimit < 0 {
+		return nil, errors.Errorf("Invalid memory limit for SpillBuffer: %d", memLimit)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, Wrapf(err, "While opening spill directory: %s.", dir)
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("Spill path is not a directory: %s", dir)
+	}
+	return &SpillBuffer{memLimit: memLimit, dir: dir}, nil
+}
+
+// Write appends data to the buffer, spilling to disk if the memory limit is exceeded.
+func (b *SpillBuffer) Write(data []byte) (int, error) {
+	if b.fd == nil {
+		if len(b.mem)+len(data) <= b.memLimit {
+			b.mem = append(b.mem, data...)
+			return len(data), nil
+		}
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := b.writer.Write(data)
+	b.size += n
+	return n, Wrapf(err, "While writing to spill file: %s.", b.fd.Name())
+}
+
+// spill moves the in-memory data to a new temporary file.
+func (b *SpillBuffer) spill() error {
+	fd, err := ioutil.TempFile(b.dir, "spill-")
+	if err != nil {
+		return Wrapf(err, "While creating spill file in: %s.", b.dir)
+	}
+	b.fd = fd
+	b.writer = bufio.NewWriterSize(fd, 1<<20)
+	n, err := b.writer.Write(b.mem)
+	b.size = n
+	b.mem = nil
+	return Wrapf(err, "While writing to spill file: %s.", fd.Name())
+}
+
+// Spilled returns true if the buffer has moved its data to disk.
+func (b *SpillBuffer) Spilled() bool {
+	return b.fd != nil
+}
+
+// Len returns the number of bytes written to the buffer.
+func (b *SpillBuffer) Len() int {
+	if b.fd == nil {
+		return len(b.mem)
+	}
+	return b.size
+}
+
+// Bytes returns all the data written to the buffer. If the buffer has spilled, the data is read
+// back from disk into a newly allocated slice.
+func (b *SpillBuffer) Bytes() ([]byte, error) {
+	if b.fd == nil {
+		return b.mem, nil
+	}
+	r, err := b.NewReader()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, b.size)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, Wrapf(err, "While reading spill file: %s.", b.fd.Name())
+	}
+	return out, nil
+}
+
+// NewReader returns a reader over the data written to the buffer so far. Writes made after
+// NewReader is called are not visible to the reader.
+func (b *SpillBuffer) NewReader() (io.Reader, error) {
+	if b.fd == nil {
+		return bytes.NewReader(b.mem), nil
+	}
+	if err := b.writer.Flush(); err != nil {
+		return nil, Wrapf(err, "While flushing spill file: %s.", b.fd.Name())
+	}
+	return io.NewSectionReader(b.fd, 0, int64(b.size)), nil
+}
+
+// Close releases the buffer's memory and removes its temporary file, if any. The file is removed
+// even if closing it fails.
+func (b *SpillBuffer) Close() error {
+	b.mem = nil
+	if b.fd == nil {
+		return nil
+	}
+	fd := b.fd
+	b.fd, b.writer, b.size = nil, nil, 0
+	// Remove the file even if closing it fails, returning the first error.
+	closeErr := fd.Close()
+	removeErr := os.Remove(fd.Name())
+	if closeErr != nil {
+		return Wrapf(closeErr, "While closing spill file: %s.", fd.Name())
+	}
+	return Wrapf(removeErr, "While removing spill file: %s.", fd.Name())
+}
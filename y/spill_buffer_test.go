@@ -0,0 +1,102 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpillBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = NewSpillBuffer(1024, "/does/not/exist")
+	require.Error(t, err)
+
+	b, err := NewSpillBuffer(1024, dir)
+	require.NoError(t, err)
+
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// Below the limit, everything stays in memory.
+	_, err = b.Write(data[:1000])
+	require.NoError(t, err)
+	_, err = b.Write(data[1000:1024])
+	require.NoError(t, err)
+	require.False(t, b.Spilled())
+	require.Equal(t, 1024, b.Len())
+	got, err := b.Bytes()
+	require.NoError(t, err)
+	require.Equal(t, data[:1024], got)
+	r, err := b.NewReader()
+	require.NoError(t, err)
+	got, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data[:1024], got)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 0)
+
+	// Crossing the limit spills everything to disk.
+	_, err = b.Write(data[1024:2000])
+	require.NoError(t, err)
+	require.True(t, b.Spilled())
+	_, err = b.Write(data[2000:])
+	require.NoError(t, err)
+	require.Equal(t, len(data), b.Len())
+	got, err = b.Bytes()
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	r, err = b.NewReader()
+	require.NoError(t, err)
+	got, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	require.NoError(t, b.Close())
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 0)
+	require.NoError(t, b.Close())
+
+	// The spill file is removed even if closing it fails.
+	b, err = NewSpillBuffer(10, dir)
+	require.NoError(t, err)
+	_, err = b.Write(data[:100])
+	require.NoError(t, err)
+	require.True(t, b.Spilled())
+	require.NoError(t, b.fd.Close())
+	err = b.Close()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "While closing spill file")
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 0)
+}
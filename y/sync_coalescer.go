@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// ErrSyncCoalescerClosed is returned by SyncCoalescer when it's used after Close.
+var ErrSyncCoalescerClosed = errors.New("SyncCoalescer is closed")
+
+// SyncCoalescer batches writes to a file so that many writers share one fsync, like a group
+// commit. Write buffers data in memory, and Flush waits until all the data written so far is
+// written to the file and synced. A background goroutine syncs at most once per window, making
+// all the writers which called Flush meanwhile wait for the same sync. It's safe for concurrent
+// use.
+type SyncCoalescer struct {
+	f      *os.File
+	window time.Duration
+
+	sync.Mutex
+	buf     *bytes.Buffer
+	spare   *bytes.Buffer // Buffer to swap in for buf on the next sync.
+	waiters []chan error  // Flush calls waiting for the next sync.
+	closed  bool
+
+	wake     chan struct{}
+	closer   *z.Closer
+	closeErr error // Error of the final sync on Close.
+	syncs    int32 // Number of syncs done, for testing.
+}
+
+// NewSyncCoalescer returns a new SyncCoalescer writing to f, and syncing at most once per window.
+// Close must be called to stop its background goroutine.
+func NewSyncCoalescer(f *os.File, window time.Duration) *SyncCoalescer {
+	c := &SyncCoalescer{
+		f:      f,
+		window: window,
+		buf:    &bytes.Buffer{},
+		spare:  &bytes.Buffer{},
+		wake:   make(chan struct{}, 1),
+		closer: z.NewCloser(1),
+	}
+	go c.run()
+	return c
+}
+
+// Write buffers p to be written to the file by the next sync. It always writes len(p) bytes, and
+// only returns an error if the SyncCoalescer is closed. Call Flush to make the data durable.
+func (c *SyncCoalescer) Write(p []byte) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return 0, ErrSyncCoalescerClosed
+	}
+	return c.buf.Write(p)
+}
+
+// Flush blocks until all the data passed to Write before the call is written to the file and
+// synced. It returns any error encountered while writing or syncing.
+func (c *SyncCoalescer) Flush() error {
+	ch := make(chan error, 1)
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return ErrSyncCoalescerClosed
+	}
+	c.waiters = append(c.waiters, ch)
+	c.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default: // A sync is already pending.
+	}
+	return <-ch
+}
+
+func (c *SyncCoalescer) run() {
+	defer c.closer.Done()
+	var last time.Time
+	for {
+		select {
+		case <-c.wake:
+		case <-c.closer.HasBeenClosed():
+			c.closeErr = c.sync()
+			return
+		}
+		// Wait for the rest of the window, collecting more writers to sync together.
+		if d := c.window - time.Since(last); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-c.closer.HasBeenClosed():
+				timer.Stop()
+			}
+		}
+		c.sync()
+		last = time.Now()
+	}
+}
+
+// sync writes the buffered data to the file, syncs it, and notifies the waiting Flush calls. It
+// returns any error encountered while writing or syncing.
+func (c *SyncCoalescer) sync() error {
+	c.Lock()
+	buf, waiters := c.buf, c.waiters
+	c.buf, c.spare, c.waiters = c.spare, nil, nil
+	c.Unlock()
+
+	var err error
+	if buf.Len() > 0 {
+		_, err = c.f.Write(buf.Bytes())
+		err = Wrapf(err, "While writing to file: %s.", c.f.Name())
+	}
+	if err == nil && (buf.Len() > 0 || len(waiters) > 0) {
+		err = Wrapf(c.f.Sync(), "While syncing file: %s.", c.f.Name())
+		atomic.AddInt32(&c.syncs, 1)
+	}
+	for _, ch := range waiters {
+		ch <- err
+	}
+
+	buf.Reset()
+	c.Lock()
+	c.spare = buf
+	c.Unlock()
+	return err
+}
+
+// Close writes and syncs any buffered data, and stops the background goroutine. It doesn't close
+// the file.
+func (c *SyncCoalescer) Close() error {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return ErrSyncCoalescerClosed
+	}
+	c.closed = true
+	c.Unlock()
+	c.closer.SignalAndWait()
+	return c.closeErr
+}
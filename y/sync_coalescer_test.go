@@ -0,0 +1,90 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncCoalescer(t *testing.T) {
+	f, err := ioutil.TempFile("", "badger-test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	c := NewSyncCoalescer(f, 5*time.Millisecond)
+	const writers, writes = 16, 20
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				rec := []byte(fmt.Sprintf("writer %d record %d\n", w, i))
+				_, err := c.Write(rec)
+				require.NoError(t, err)
+				require.NoError(t, c.Flush())
+
+				// Once Flush returns, the record is in the file.
+				data, err := ioutil.ReadFile(f.Name())
+				require.NoError(t, err)
+				require.True(t, bytes.Contains(data, rec), "record: %s", rec)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	syncs := atomic.LoadInt32(&c.syncs)
+	require.Less(t, int(syncs), writers*writes/4)
+
+	// Close writes out data which wasn't flushed.
+	_, err = c.Write([]byte("last\n"))
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+	data, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, writers*writes+1, bytes.Count(data, []byte("\n")))
+	require.True(t, bytes.HasSuffix(data, []byte("last\n")))
+
+	_, err = c.Write([]byte("foo"))
+	require.Equal(t, ErrSyncCoalescerClosed, err)
+	require.Equal(t, ErrSyncCoalescerClosed, c.Flush())
+	require.Equal(t, ErrSyncCoalescerClosed, c.Close())
+}
+
+func TestSyncCoalescerError(t *testing.T) {
+	f, err := ioutil.TempFile("", "badger-test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, f.Close())
+
+	// Writing to a closed file fails, and the error is passed on to Flush.
+	c := NewSyncCoalescer(f, time.Millisecond)
+	_, err = c.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.Error(t, c.Flush())
+	require.NoError(t, c.Close())
+}
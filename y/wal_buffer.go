@@ -0,0 +1,116 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+// walSegment is a PageBuffer holding the frames of consecutive records of a WALBuffer.
+type walSegment struct {
+	buf   *PageBuffer
+	first uint64 // Sequence number of the first record.
+	n     int    // Number of records.
+}
+
+// WALBuffer holds records in FIFO order for write-ahead log style replay. Each record is assigned
+// an increasing sequence number, starting from 1, and records can be dropped once they're
+// acknowledged. Records are stored as frames in PageBuffers of about pageSize bytes, which are
+// released once all their records are acknowledged. Its functions are not thread safe.
+type WALBuffer struct {
+	pageSize int
+	segments []*walSegment
+	next     uint64 // Sequence number of the next record.
+	acked    uint64 // Records up to acked have been acknowledged.
+	size     int    // Bytes held by segments.
+}
+
+// NewWALBuffer returns a new, empty WALBuffer which allocates segments of pageSize bytes.
+func NewWALBuffer(pageSize int) *WALBuffer {
+	AssertTruef(pageSize > 0, "WALBuffer page size must be positive, got: %d", pageSize)
+	return &WALBuffer{pageSize: pageSize, next: 1}
+}
+
+// Append appends record to the buffer, and returns its sequence number.
+func (w *WALBuffer) Append(record []byte) uint64 {
+	var seg *walSegment
+	if n := len(w.segments); n > 0 && w.segments[n-1].buf.Len() < w.pageSize {
+		seg = w.segments[n-1]
+	} else {
+		seg = &walSegment{buf: NewPageBuffer(w.pageSize), first: w.next}
+		w.segments = append(w.segments, seg)
+	}
+	w.size += seg.buf.WriteFrame(record)
+	seg.n++
+	w.next++
+	return w.next - 1
+}
+
+// Iterate calls fn with each record which hasn't been acknowledged, and whose sequence number is
+// at least from, in order. It stops at the first error returned by fn and returns it. fn may
+// retain the records it's passed, but must not modify the WALBuffer.
+func (w *WALBuffer) Iterate(from uint64, fn func(seq uint64, rec []byte) error) error {
+	if from <= w.acked {
+		from = w.acked + 1
+	}
+	for _, seg := range w.segments {
+		if seg.first+uint64(seg.n) <= from {
+			continue
+		}
+		r := seg.buf.NewReaderAt(0)
+		for seq := seg.first; seq < seg.first+uint64(seg.n); seq++ {
+			rec, err := NextFrame(r)
+			if err != nil {
+				return Wrapf(err, "While reading WALBuffer record: %d", seq)
+			}
+			if seq < from {
+				continue
+			}
+			if err := fn(seq, rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Ack acknowledges the records with sequence numbers up to upto, so that they're no longer
+// iterated over. The memory of segments whose records have all been acknowledged is released.
+func (w *WALBuffer) Ack(upto uint64) {
+	if upto >= w.next {
+		upto = w.next - 1
+	}
+	if upto <= w.acked {
+		return
+	}
+	w.acked = upto
+	drop := 0
+	for _, seg := range w.segments {
+		if seg.first+uint64(seg.n)-1 > upto {
+			break
+		}
+		w.size -= seg.buf.Len()
+		drop++
+	}
+	n := copy(w.segments, w.segments[drop:])
+	for i := n; i < len(w.segments); i++ {
+		w.segments[i] = nil // Release the dropped segments.
+	}
+	w.segments = w.segments[:n]
+}
+
+// Size returns the number of bytes held by the buffer, including acknowledged records which
+// haven't been released yet.
+func (w *WALBuffer) Size() int {
+	return w.size
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// walRecords returns the records of w iterated from from.
+func walRecords(t *testing.T, w *WALBuffer, from uint64) map[uint64]string {
+	got := make(map[uint64]string)
+	var last uint64
+	require.NoError(t, w.Iterate(from, func(seq uint64, rec []byte) error {
+		require.True(t, seq > last, "seq: %d, last: %d", seq, last)
+		last = seq
+		got[seq] = string(rec)
+		return nil
+	}))
+	return got
+}
+
+func TestWALBuffer(t *testing.T) {
+	w := NewWALBuffer(64)
+	require.Empty(t, walRecords(t, w, 0))
+
+	want := make(map[uint64]string)
+	for i := 1; i <= 100; i++ {
+		rec := fmt.Sprintf("record-%d", i)
+		require.Equal(t, uint64(i), w.Append([]byte(rec)))
+		want[uint64(i)] = rec
+	}
+	require.Equal(t, want, walRecords(t, w, 0))
+	require.Equal(t, want, walRecords(t, w, 1))
+
+	// Iterating from a midpoint.
+	got := walRecords(t, w, 60)
+	require.Len(t, got, 41)
+	require.Equal(t, "record-60", got[60])
+	require.Empty(t, walRecords(t, w, 101))
+
+	// Acking frees memory, and acked records are no longer iterated over.
+	size := w.Size()
+	w.Ack(50)
+	require.True(t, w.Size() < size, "size: %d, before: %d", w.Size(), size)
+	got = walRecords(t, w, 0)
+	require.Len(t, got, 50)
+	require.Equal(t, "record-51", got[51])
+	require.Len(t, walRecords(t, w, 90), 11)
+
+	// Acking backwards is a no-op.
+	w.Ack(10)
+	require.Len(t, walRecords(t, w, 0), 50)
+
+	// Records can still be appended after acking everything.
+	w.Ack(1000)
+	require.Zero(t, w.Size())
+	require.Empty(t, walRecords(t, w, 0))
+	require.Equal(t, uint64(101), w.Append([]byte("last")))
+	require.Equal(t, map[uint64]string{101: "last"}, walRecords(t, w, 0))
+	require.Equal(t, len("last")+1, w.Size())
+}
+
+func TestWALBufferIterateError(t *testing.T) {
+	w := NewWALBuffer(16)
+	for i := 0; i < 10; i++ {
+		w.Append([]byte("foo"))
+	}
+	errStop := errors.New("stop")
+	var calls int
+	err := w.Iterate(0, func(seq uint64, rec []byte) error {
+		if calls++; seq == 5 {
+			return errStop
+		}
+		return nil
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, 5, calls)
+}
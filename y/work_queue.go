@@ -0,0 +1,138 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"sync"
+
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/pkg/errors"
+)
+
+// ErrWorkQueueClosed is returned by WorkQueue.Submit after Close.
+var ErrWorkQueueClosed = errors.New("WorkQueue is closed")
+
+// WorkQueue processes tasks with a function, running up to a given number of them concurrently.
+// Submit blocks while that many tasks are running, so producers can't get ahead of the workers.
+// The errors returned by the function are delivered on Errors. It's safe for concurrent use.
+type WorkQueue struct {
+	fn       func(task interface{}) error
+	throttle *Throttle
+	closer   *z.Closer
+	errCh    chan error
+
+	// Workers append their errors to pending rather than sending them on errCh, so that they never
+	// wait for the reader of Errors. forwardErrors sends them on errCh, and closes it once
+	// tasksDone is set and pending is empty. notify wakes it up after either changes.
+	errMu     sync.Mutex
+	pending   []error
+	tasksDone bool
+	notify    chan struct{}
+
+	// Submit holds a read lock while starting a task, so that Close doesn't wait for the running
+	// tasks before all of them are started.
+	sync.RWMutex
+}
+
+// NewWorkQueue returns a new WorkQueue calling fn for each task, in up to workers goroutines.
+func NewWorkQueue(workers int, fn func(task interface{}) error) *WorkQueue {
+	AssertTruef(workers > 0, "WorkQueue needs at least one worker, got: %d", workers)
+	q := &WorkQueue{
+		fn:       fn,
+		throttle: NewThrottle(workers),
+		closer:   z.NewCloser(0),
+		errCh:    make(chan error),
+		notify:   make(chan struct{}, 1),
+	}
+	go q.forwardErrors()
+	return q
+}
+
+// forwardErrors sends the pending errors on errCh, in the order they were added, and closes it
+// once all tasks are done.
+func (q *WorkQueue) forwardErrors() {
+	for {
+		q.errMu.Lock()
+		errs, done := q.pending, q.tasksDone
+		q.pending = nil
+		q.errMu.Unlock()
+
+		for _, err := range errs {
+			q.errCh <- err
+		}
+		if len(errs) > 0 {
+			continue
+		}
+		if done {
+			close(q.errCh)
+			return
+		}
+		<-q.notify
+	}
+}
+
+// wakeForwarder wakes up forwardErrors, if it isn't already due to wake up.
+func (q *WorkQueue) wakeForwarder() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Submit submits task to be processed, blocking until a worker is available. It returns
+// ErrWorkQueueClosed if the queue is closed.
+func (q *WorkQueue) Submit(task interface{}) error {
+	q.RLock()
+	defer q.RUnlock()
+	if Signalled(q.closer) {
+		return ErrWorkQueueClosed
+	}
+	// Errors of tasks are sent on errCh rather than passed to Done, so Do never fails.
+	Check(q.throttle.Do())
+	go func() {
+		defer q.throttle.Done(nil)
+		if err := q.fn(task); err != nil {
+			q.errMu.Lock()
+			q.pending = append(q.pending, err)
+			q.errMu.Unlock()
+			q.wakeForwarder()
+		}
+	}()
+	return nil
+}
+
+// Errors returns the channel on which the errors of tasks are delivered. It's closed once Close
+// has been called, all tasks are done and their errors have been read. Errors are queued until
+// they are read, so neither workers nor Close wait for the reader, and the channel can be read
+// after Close returns.
+func (q *WorkQueue) Errors() <-chan error {
+	return q.errCh
+}
+
+// Close stops accepting new tasks, and waits for all submitted tasks to be done. The channel
+// returned by Errors is closed once their errors have been read. Close must be called only once.
+func (q *WorkQueue) Close() {
+	q.Lock()
+	q.closer.Signal()
+	q.Unlock()
+	Check(q.throttle.Finish())
+
+	q.errMu.Lock()
+	q.tasksDone = true
+	q.errMu.Unlock()
+	q.wakeForwarder()
+}
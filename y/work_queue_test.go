@@ -0,0 +1,132 @@
+/*
+ * Copyright 2021 Dgraph Labs, Inc. and Contributors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package y
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkQueue(t *testing.T) {
+	var running, maxRunning, sum int32
+	q := NewWorkQueue(4, func(task interface{}) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&sum, int32(task.(int)))
+		if task.(int) == 13 {
+			return errors.New("unlucky task")
+		}
+		return nil
+	})
+
+	var errs []error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for err := range q.Errors() {
+			errs = append(errs, err)
+		}
+	}()
+
+	want := 0
+	for i := 1; i <= 100; i++ {
+		require.NoError(t, q.Submit(i))
+		want += i
+	}
+	// Close drains the remaining tasks.
+	q.Close()
+	require.Equal(t, int32(want), atomic.LoadInt32(&sum))
+	require.Zero(t, atomic.LoadInt32(&running))
+	require.True(t, atomic.LoadInt32(&maxRunning) <= 4)
+
+	wg.Wait()
+	require.Len(t, errs, 1)
+	require.Contains(t, errs[0].Error(), "unlucky task")
+
+	require.Equal(t, ErrWorkQueueClosed, q.Submit(1))
+}
+
+func TestWorkQueueConcurrentSubmit(t *testing.T) {
+	var done int32
+	q := NewWorkQueue(2, func(task interface{}) error {
+		atomic.AddInt32(&done, 1)
+		return nil
+	})
+	var wg sync.WaitGroup
+	var submitted int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if q.Submit(j) == nil {
+					atomic.AddInt32(&submitted, 1)
+				}
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond)
+	q.Close()
+	wg.Wait()
+	// Every accepted task was processed.
+	require.Equal(t, atomic.LoadInt32(&submitted), atomic.LoadInt32(&done))
+	_, ok := <-q.Errors()
+	require.False(t, ok)
+}
+
+func TestWorkQueueErrorsReadAfterClose(t *testing.T) {
+	// More tasks fail than there are workers, and no one reads Errors until Close returns.
+	q := NewWorkQueue(1, func(task interface{}) error {
+		return errors.Errorf("task %d failed", task.(int))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, q.Submit(i))
+		}
+		q.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Submit or Close blocked on unread errors")
+	}
+
+	var errs []string
+	for err := range q.Errors() {
+		errs = append(errs, err.Error())
+	}
+	require.Len(t, errs, 10)
+	for i, err := range errs {
+		require.Equal(t, fmt.Sprintf("task %d failed", i), err)
+	}
+}
@@ -22,16 +22,23 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"math"
+	"math/bits"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
 
 	"github.com/dgraph-io/badger/v3/pb"
 	"github.com/dgraph-io/ristretto/z"
+	humanize "github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 )
 
@@ -40,9 +47,21 @@ var (
 	// and encountering the end of slice.
 	ErrEOF = errors.New("ErrEOF: End of file")
 
+	// ErrTruncated indicates that a read from a memory mapped file stopped short of the data it
+	// expected, e.g. because the file was truncated unexpectedly. Unlike ErrEOF, it means that the
+	// data is incomplete.
+	ErrTruncated = errors.New("ErrTruncated: Unexpected file truncation")
+
 	// ErrCommitAfterFinish indicates that write batch commit was called after
 	// finish
 	ErrCommitAfterFinish = errors.New("Batch commit not permitted after finish")
+
+	// ErrThrottleMismatch is the value Throttle.Done panics with when it is called without a
+	// matching call to Throttle.Do.
+	ErrThrottleMismatch = errors.New("Throttle Do Done mismatch")
+
+	// ErrPageBufferFrozen is the value PageBuffer panics with when it is modified after Freeze.
+	ErrPageBufferFrozen = errors.New("PageBuffer modified after Freeze")
 )
 
 type Flags int
@@ -54,6 +73,13 @@ const (
 	Sync Flags = 1 << iota
 	// ReadOnly opens the underlying file on a read-only basis.
 	ReadOnly
+	// FullSync indicates that O_SYNC should be set on the underlying file,
+	// ensuring that writes do not return until both the data and the file
+	// metadata (e.g. size and modification time) are flushed to disk. This is
+	// needed on filesystems which update inodes lazily, but makes writes slower
+	// than with Sync. It takes precedence over Sync. Use it with OpenExistingFile,
+	// CreateSyncedFileWithFlags or OpenSyncedFileWithFlags.
+	FullSync
 )
 
 var (
@@ -71,28 +97,97 @@ func OpenExistingFile(filename string, flags Flags) (*os.File, error) {
 		openFlags = os.O_RDONLY
 	}
 
-	if flags&Sync != 0 {
-		openFlags |= datasyncFileFlag
-	}
+	openFlags |= syncFileFlag(flags)
 	return os.OpenFile(filename, openFlags, 0)
 }
 
+// syncFileFlag returns the open flag matching the Sync and FullSync bits of flags.
+func syncFileFlag(flags Flags) int {
+	switch {
+	case flags&FullSync != 0:
+		return os.O_SYNC
+	case flags&Sync != 0:
+		return datasyncFileFlag
+	}
+	return 0
+}
+
+// boolSyncFlags returns Sync if sync is set, for the helpers taking a sync bool.
+func boolSyncFlags(sync bool) Flags {
+	if sync {
+		return Sync
+	}
+	return 0
+}
+
+// OpenExistingFileLocked opens an existing file like OpenExistingFile, and acquires an advisory
+// lock on it. The lock is shared if flags has ReadOnly set, and exclusive otherwise. It errors
+// immediately if another process holds a conflicting lock. The returned function releases the lock;
+// the file still needs to be closed by the caller.
+func OpenExistingFileLocked(filename string, flags Flags) (*os.File, func() error, error) {
+	f, err := OpenExistingFile(filename, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := lockFile(f, flags&ReadOnly != 0); err != nil {
+		f.Close()
+		return nil, nil, Wrapf(err, "Cannot acquire lock on file: %s.", filename)
+	}
+	unlock := func() error {
+		return Wrapf(unlockFile(f), "Cannot release lock on file: %s.", filename)
+	}
+	return f, unlock, nil
+}
+
 // CreateSyncedFile creates a new file (using O_EXCL), errors if it already existed.
 func CreateSyncedFile(filename string, sync bool) (*os.File, error) {
-	flags := os.O_RDWR | os.O_CREATE | os.O_EXCL
-	if sync {
-		flags |= datasyncFileFlag
+	return CreateSyncedFileWithFlags(filename, boolSyncFlags(sync))
+}
+
+// CreateSyncedFileWithFlags is like CreateSyncedFile, but takes Flags so that FullSync can be
+// used. Only the Sync and FullSync bits of flags are considered.
+func CreateSyncedFileWithFlags(filename string, flags Flags) (*os.File, error) {
+	openFlags := os.O_RDWR | os.O_CREATE | os.O_EXCL | syncFileFlag(flags)
+	return os.OpenFile(filename, openFlags, 0600)
+}
+
+// maxUniqueFileAttempts is the number of names CreateUniqueSyncedFile tries before giving up.
+const maxUniqueFileAttempts = 10
+
+// uniqueFileSuffix returns a random suffix for the names tried by CreateUniqueSyncedFile.
+var uniqueFileSuffix = func() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+// CreateUniqueSyncedFile creates a new file in dir, with a name of prefix followed by a random
+// suffix, using CreateSyncedFile. If a file with the name already exists, it retries with a new
+// suffix, up to maxUniqueFileAttempts times.
+func CreateUniqueSyncedFile(dir, prefix string, sync bool) (*os.File, error) {
+	var err error
+	for i := 0; i < maxUniqueFileAttempts; i++ {
+		var f *os.File
+		path := filepath.Join(dir, prefix+uniqueFileSuffix())
+		if f, err = CreateSyncedFile(path, sync); err == nil {
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, Wrapf(err, "While creating file: %s", path)
+		}
 	}
-	return os.OpenFile(filename, flags, 0600)
+	return nil, Wrapf(err, "While creating unique file in: %s, after %d attempts",
+		dir, maxUniqueFileAttempts)
 }
 
 // OpenSyncedFile creates the file if one doesn't exist.
 func OpenSyncedFile(filename string, sync bool) (*os.File, error) {
-	flags := os.O_RDWR | os.O_CREATE
-	if sync {
-		flags |= datasyncFileFlag
-	}
-	return os.OpenFile(filename, flags, 0600)
+	return OpenSyncedFileWithFlags(filename, boolSyncFlags(sync))
+}
+
+// OpenSyncedFileWithFlags is like OpenSyncedFile, but takes Flags so that FullSync can be used.
+// Only the Sync and FullSync bits of flags are considered.
+func OpenSyncedFileWithFlags(filename string, flags Flags) (*os.File, error) {
+	openFlags := os.O_RDWR | os.O_CREATE | syncFileFlag(flags)
+	return os.OpenFile(filename, openFlags, 0600)
 }
 
 // OpenTruncFile opens the file with O_RDWR | O_CREATE | O_TRUNC
@@ -104,11 +199,111 @@ func OpenTruncFile(filename string, sync bool) (*os.File, error) {
 	return os.OpenFile(filename, flags, 0600)
 }
 
-// SafeCopy does append(a[:0], src...).
+// syncFilesConcurrency is the number of files SyncFiles syncs concurrently.
+const syncFilesConcurrency = 8
+
+// SyncFiles fsyncs files concurrently, up to syncFilesConcurrency at a time, which is faster than
+// syncing them one after the other. All files are synced even if some of them fail, and the first
+// error encountered is returned.
+func SyncFiles(files []*os.File) error {
+	var mu sync.Mutex
+	var firstErr error
+	throttle := NewThrottle(syncFilesConcurrency)
+	for _, f := range files {
+		// Errors are collected below rather than passed to Done, so Do never fails.
+		Check(throttle.Do())
+		go func(f *os.File) {
+			defer throttle.Done(nil)
+			if err := f.Sync(); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = Wrapf(err, "While syncing file: %s", f.Name())
+				}
+				mu.Unlock()
+			}
+		}(f)
+	}
+	Check(throttle.Finish())
+	return firstErr
+}
+
+// AtomicWriteFile replaces the contents of path with data, such that readers either see the old
+// contents or the new ones, never a partial write. The data is written to a temporary file in the
+// same directory, which is then renamed over path. If sync is true, the temporary file is synced
+// before the rename and the directory is synced after it, so that the replacement survives a crash.
+func AtomicWriteFile(path string, data []byte, sync bool) error {
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return Wrapf(err, "While creating temp file in directory: %s.", dir)
+	}
+	tmpName := f.Name()
+	// Remove the temp file if we fail before the rename. After a successful rename, this is a
+	// no-op returning an error which we ignore.
+	defer os.Remove(tmpName)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return Wrapf(err, "While writing to temp file: %s.", tmpName)
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return Wrapf(err, "While syncing temp file: %s.", tmpName)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return Wrapf(err, "While closing temp file: %s.", tmpName)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return Wrapf(err, "While renaming temp file %s to %s.", tmpName, path)
+	}
+	if sync {
+		return SyncDir(dir)
+	}
+	return nil
+}
+
+// TempDir creates a new temporary directory whose name starts with prefix, in the default
+// directory for temporary files. It returns the directory, and a cleanup function which removes it
+// along with its contents. Calling cleanup more than once is a no-op.
+func TempDir(prefix string) (string, func(), error) {
+	dir, err := ioutil.TempDir("", prefix)
+	if err != nil {
+		return "", nil, Wrapf(err, "While creating temp directory with prefix: %s.", prefix)
+	}
+	var once sync.Once
+	cleanup := func() {
+		once.Do(func() { os.RemoveAll(dir) })
+	}
+	return dir, cleanup, nil
+}
+
+// SafeCopy does append(a[:0], src...). The result reuses the backing array of a if it's large
+// enough, so it may alias a.
 func SafeCopy(a, src []byte) []byte {
 	return append(a[:0], src...)
 }
 
+// SafeCopyInto copies src into dst, reusing the backing array of dst if it's large enough, and
+// returns the result. It allocates only if cap(dst) < len(src), so it can be used like Copy in hot
+// paths. Unlike SafeCopy, the result never aliases src, even if dst and src share memory.
+func SafeCopyInto(dst, src []byte) []byte {
+	if overlaps(dst[:cap(dst)], src) {
+		dst = nil
+	}
+	return append(dst[:0], src...)
+}
+
+// overlaps returns true if a and b share any memory.
+func overlaps(a, b []byte) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	aStart, bStart := uintptr(unsafe.Pointer(&a[0])), uintptr(unsafe.Pointer(&b[0]))
+	return aStart < bStart+uintptr(len(b)) && bStart < aStart+uintptr(len(a))
+}
+
 // Copy copies a byte slice and returns the copied slice.
 func Copy(a []byte) []byte {
 	b := make([]byte, len(a))
@@ -116,16 +311,52 @@ func Copy(a []byte) []byte {
 	return b
 }
 
+// EncodeTsSuffix returns the 8 byte suffix encoding ts in a key. The suffix holds
+// math.MaxUint64-ts in big endian order, so that higher versions of the same key sort first.
+func EncodeTsSuffix(ts uint64) [8]byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.MaxUint64-ts)
+	return b
+}
+
+// DecodeTsSuffix returns the timestamp encoded in the 8 byte key suffix b. It's the inverse of
+// EncodeTsSuffix.
+func DecodeTsSuffix(b [8]byte) uint64 {
+	return math.MaxUint64 - binary.BigEndian.Uint64(b[:])
+}
+
 func SetKeyTs(key []byte, ts uint64) {
-	start := len(key) - 8
-	binary.BigEndian.PutUint64(key[start:], math.MaxUint64-ts)
+	suffix := EncodeTsSuffix(ts)
+	copy(key[len(key)-8:], suffix[:])
 }
 
 // KeyWithTs generates a new key by appending ts to key.
 func KeyWithTs(key []byte, ts uint64) []byte {
 	out := make([]byte, len(key)+8)
 	copy(out, key)
-	binary.BigEndian.PutUint64(out[len(key):], math.MaxUint64-ts)
+	suffix := EncodeTsSuffix(ts)
+	copy(out[len(key):], suffix[:])
+	return out
+}
+
+// KeysWithTs generates new keys by appending ts to each of keys, like KeyWithTs. All the generated
+// keys share a single allocation. Each of them is capped to its length, so appending to one doesn't
+// overwrite another.
+func KeysWithTs(keys [][]byte, ts uint64) [][]byte {
+	sz := 0
+	for _, key := range keys {
+		sz += len(key) + 8
+	}
+	buf := make([]byte, sz)
+	out := make([][]byte, len(keys))
+	suffix := EncodeTsSuffix(ts)
+	for i, key := range keys {
+		n := len(key) + 8
+		out[i] = buf[:n:n]
+		copy(out[i], key)
+		copy(out[i][len(key):], suffix[:])
+		buf = buf[n:]
+	}
 	return out
 }
 
@@ -134,7 +365,18 @@ func ParseTs(key []byte) uint64 {
 	if len(key) <= 8 {
 		return 0
 	}
-	return math.MaxUint64 - binary.BigEndian.Uint64(key[len(key)-8:])
+	var suffix [8]byte
+	copy(suffix[:], key[len(key)-8:])
+	return DecodeTsSuffix(suffix)
+}
+
+// ParseTsBatch parses the timestamps from each of keys, like ParseTs.
+func ParseTsBatch(keys [][]byte) []uint64 {
+	out := make([]uint64, len(keys))
+	for i, key := range keys {
+		out[i] = ParseTs(key)
+	}
+	return out
 }
 
 // CompareKeys checks the key without timestamp and checks the timestamp if keyNoTs
@@ -148,6 +390,66 @@ func CompareKeys(key1, key2 []byte) int {
 	return bytes.Compare(key1[len(key1)-8:], key2[len(key2)-8:])
 }
 
+// CompareKeysAndSameKey returns the result of CompareKeys(key1, key2), along with whether the keys
+// have the same user key, i.e. differ only by version. It compares the user keys once, which is
+// cheaper than calling both CompareKeys and SameKey.
+func CompareKeysAndSameKey(key1, key2 []byte) (int, bool) {
+	if cmp := bytes.Compare(key1[:len(key1)-8], key2[:len(key2)-8]); cmp != 0 {
+		return cmp, false
+	}
+	return bytes.Compare(key1[len(key1)-8:], key2[len(key2)-8:]), true
+}
+
+// CompareKeysNoTs compares only the user keys of key1 and key2, ignoring their timestamps. Unlike
+// CompareKeys, it returns 0 for two versions of the same key.
+func CompareKeysNoTs(key1, key2 []byte) int {
+	return bytes.Compare(ParseKey(key1), ParseKey(key2))
+}
+
+// MinKey returns the smallest of keys according to CompareKeys, or nil if there are no keys.
+func MinKey(keys ...[]byte) []byte {
+	var min []byte
+	for _, key := range keys {
+		if min == nil || CompareKeys(key, min) < 0 {
+			min = key
+		}
+	}
+	return min
+}
+
+// MaxKey returns the largest of keys according to CompareKeys, or nil if there are no keys.
+func MaxKey(keys ...[]byte) []byte {
+	var max []byte
+	for _, key := range keys {
+		if max == nil || CompareKeys(key, max) > 0 {
+			max = key
+		}
+	}
+	return max
+}
+
+// LatestVersions returns the latest version of each user key in keys, which must be sorted by
+// CompareKeys, i.e. the first key with each user key. The returned list shares the keys with keys.
+func LatestVersions(keys [][]byte) [][]byte {
+	var out [][]byte
+	for _, key := range keys {
+		if len(out) == 0 || !SameKey(out[len(out)-1], key) {
+			out = append(out, key)
+		}
+	}
+	return out
+}
+
+// InsertSorted inserts key into keys, which must be sorted by CompareKeys, keeping it sorted, and
+// returns the updated list. If keys already holds key, it's inserted after the existing copies.
+func InsertSorted(keys [][]byte, key []byte) [][]byte {
+	i := sort.Search(len(keys), func(i int) bool { return CompareKeys(keys[i], key) > 0 })
+	keys = append(keys, nil)
+	copy(keys[i+1:], keys[i:])
+	keys[i] = key
+	return keys
+}
+
 // ParseKey parses the actual key from the key bytes.
 func ParseKey(key []byte) []byte {
 	if key == nil {
@@ -157,6 +459,126 @@ func ParseKey(key []byte) []byte {
 	return key[:len(key)-8]
 }
 
+// ParseKeyInto copies the actual key from the key bytes into dst, growing it if needed. Unlike
+// ParseKey, the returned slice doesn't alias key.
+func ParseKeyInto(dst, key []byte) []byte {
+	return append(dst[:0], ParseKey(key)...)
+}
+
+// StripPrefix removes prefix from the user key portion of key, keeping its timestamp suffix. It
+// returns the remaining key, which aliases key, and whether the user key had the prefix. If it
+// didn't, key is returned as is.
+func StripPrefix(key, prefix []byte) ([]byte, bool) {
+	if len(key) < 8 || !bytes.HasPrefix(ParseKey(key), prefix) {
+		return key, false
+	}
+	return key[len(prefix):], true
+}
+
+// SafeKeyString returns a printable representation of key for logging. It renders the user key
+// with bytes other than printable ASCII, and backslashes, hex-escaped like \x00, followed by the
+// timestamp, e.g. foo\x00bar@ts=42. Keys too short to hold a timestamp are rendered without one.
+func SafeKeyString(key []byte) string {
+	const hex = "0123456789abcdef"
+	userKey, hasTs := key, len(key) >= 8
+	if hasTs {
+		userKey = ParseKey(key)
+	}
+	var b strings.Builder
+	b.Grow(len(userKey) + 24)
+	for _, c := range userKey {
+		if c >= 0x20 && c < 0x7f && c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString(`\x`)
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	if hasTs {
+		// Unlike ParseTs, this also decodes the timestamp of an empty user key.
+		var suffix [8]byte
+		copy(suffix[:], key[len(key)-8:])
+		b.WriteString("@ts=")
+		b.WriteString(strconv.FormatUint(DecodeTsSuffix(suffix), 10))
+	}
+	return b.String()
+}
+
+// Component encoding used by EncodeComponents. Zero bytes within a component are escaped, and each
+// component is terminated by a sequence which sorts before any escaped or non-zero byte.
+const (
+	componentEscape     = 0x00
+	componentEscapedNul = 0xff
+	componentTerminator = 0x01
+)
+
+// EncodeComponents encodes parts into a single key, such that comparing encoded keys with
+// bytes.Compare orders them by their components, compared one by one. Each component can hold
+// arbitrary bytes. Use DecodeComponents to get the components back.
+func EncodeComponents(parts ...[]byte) []byte {
+	sz := 0
+	for _, part := range parts {
+		sz += len(part) + 2
+	}
+	out := make([]byte, 0, sz)
+	for _, part := range parts {
+		for _, c := range part {
+			if c == componentEscape {
+				out = append(out, componentEscape, componentEscapedNul)
+			} else {
+				out = append(out, c)
+			}
+		}
+		out = append(out, componentEscape, componentTerminator)
+	}
+	return out
+}
+
+// DecodeComponents decodes a key encoded by EncodeComponents into its components.
+func DecodeComponents(key []byte) ([][]byte, error) {
+	var parts [][]byte
+	part := []byte{}
+	for i := 0; i < len(key); i++ {
+		if key[i] != componentEscape {
+			part = append(part, key[i])
+			continue
+		}
+		if i+1 == len(key) {
+			return nil, errors.Errorf("Truncated escape sequence at offset: %d", i)
+		}
+		i++
+		switch key[i] {
+		case componentEscapedNul:
+			part = append(part, 0)
+		case componentTerminator:
+			parts = append(parts, part)
+			part = []byte{}
+		default:
+			return nil, errors.Errorf("Invalid escape sequence: %#x at offset: %d", key[i], i-1)
+		}
+	}
+	if len(part) > 0 {
+		return nil, errors.New("Unterminated component at end of key")
+	}
+	return parts, nil
+}
+
+// KeySuccessor returns the smallest key which is greater than all keys having the given prefix,
+// so that a prefix scan can be expressed as the range [prefix, KeySuccessor(prefix)). It operates
+// on user keys, without timestamps. It returns nil if there is no such key, i.e. if prefix is
+// empty or consists of 0xff bytes only, which means the range is unbounded above.
+func KeySuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			out := Copy(prefix[:i+1])
+			out[i]++
+			return out
+		}
+	}
+	return nil
+}
+
 // SameKey checks for key equality ignoring the version timestamp suffix.
 func SameKey(src, dst []byte) bool {
 	if len(src) != len(dst) {
@@ -165,6 +587,26 @@ func SameKey(src, dst []byte) bool {
 	return bytes.Equal(ParseKey(src), ParseKey(dst))
 }
 
+// MemHash returns a fast, non-cryptographic hash of b, suitable for sharding keys across workers.
+// The hash seed changes for every process, so the values are only stable within a process and must
+// not be persisted.
+func MemHash(b []byte) uint64 {
+	return z.MemHash(b)
+}
+
+// KeyFingerprint returns a hash of the user key of key, ignoring its timestamp, using MemHash.
+// Different fingerprints imply different user keys, so they can short-circuit comparisons, but
+// equal fingerprints don't imply equal user keys, and fingerprints say nothing about the order of
+// keys. Callers must fall back to comparing the keys when fingerprints match.
+func KeyFingerprint(key []byte) uint64 {
+	return MemHash(ParseKey(key))
+}
+
+// MemHashString is MemHash for a string. It returns the same value as MemHash([]byte(s)).
+func MemHashString(s string) uint64 {
+	return z.MemHashString(s)
+}
+
 // Slice holds a reusable buf, will reallocate if you request a larger size than ever before.
 // One problem is with n distinct sizes in random order it'll reallocate log(n) times.
 type Slice struct {
@@ -180,9 +622,143 @@ func (s *Slice) Resize(sz int) []byte {
 	return s.buf[0:sz]
 }
 
+// ResizeLimited is like Resize, but returns an error instead of allocating if sz is larger than
+// max. It guards against allocating pathological sizes, e.g. from a corrupted length field.
+func (s *Slice) ResizeLimited(sz, max int) ([]byte, error) {
+	if sz > max {
+		return nil, errors.Errorf("Slice size: %d exceeds the limit: %d", sz, max)
+	}
+	return s.Resize(sz), nil
+}
+
+// ScratchSlice holds a reusable buf split into two regions, a scratch one and a result one, which
+// never overlap, e.g. for encoders which need a temporary buffer besides their output. Like Slice,
+// it only reallocates when a region grows larger than ever before. The contents of both regions
+// are preserved when reallocating, but slices returned before then no longer point into buf.
+type ScratchSlice struct {
+	buf        []byte
+	scratchCap int // The scratch region is buf[:scratchCap], and the result region follows it.
+	scratchLen int // Sizes last requested for each region, which are preserved on reallocation.
+	resultLen  int
+}
+
+// grow reallocates buf, so that it holds a scratch region of scratchCap bytes followed by a result
+// region of resultCap bytes, preserving the contents of both regions.
+func (s *ScratchSlice) grow(scratchCap, resultCap int) {
+	buf := make([]byte, 2*(scratchCap+resultCap))
+	copy(buf, s.buf[:s.scratchLen])
+	copy(buf[scratchCap:], s.buf[s.scratchCap:s.scratchCap+s.resultLen])
+	s.buf, s.scratchCap = buf, scratchCap
+}
+
+// Scratch returns the scratch region resized to sz bytes.
+func (s *ScratchSlice) Scratch(sz int) []byte {
+	if sz > s.scratchCap {
+		// Leave room for the scratch region to grow further.
+		s.grow(2*sz, s.resultLen)
+	}
+	s.scratchLen = sz
+	return s.buf[:sz:sz]
+}
+
+// Result returns the result region resized to sz bytes.
+func (s *ScratchSlice) Result(sz int) []byte {
+	if s.scratchCap+sz > len(s.buf) {
+		s.grow(s.scratchCap, sz)
+	}
+	s.resultLen = sz
+	return s.buf[s.scratchCap : s.scratchCap+sz : s.scratchCap+sz]
+}
+
+// maxSliceClass is the size class of the largest buffers pooled by SlicePool.
+const maxSliceClass = 30
+
+// SlicePool is a pool of byte slices, bucketed into power of two size classes. It's safe for
+// concurrent use.
+type SlicePool struct {
+	pools [maxSliceClass + 1]sync.Pool // pools[i] holds slices with capacity of at least 1<<i.
+}
+
+// NewSlicePool returns a new SlicePool.
+func NewSlicePool() *SlicePool {
+	return &SlicePool{}
+}
+
+// Get returns a slice of length sz from the pool. Its capacity is sz rounded up to a power of two.
+// Its contents are arbitrary.
+func (p *SlicePool) Get(sz int) []byte {
+	class := bits.Len(uint(sz - 1))
+	if sz <= 0 {
+		class = 0
+	}
+	if class > maxSliceClass {
+		return make([]byte, sz)
+	}
+	if b, ok := p.pools[class].Get().(*[]byte); ok {
+		return (*b)[:sz]
+	}
+	return make([]byte, sz, 1<<uint(class))
+}
+
+// Put returns b to the pool, so that it can be returned by Get. b must not be used after calling
+// Put.
+func (p *SlicePool) Put(b []byte) {
+	if cap(b) == 0 {
+		return
+	}
+	class := bits.Len(uint(cap(b))) - 1
+	if class > maxSliceClass {
+		return
+	}
+	b = b[:0]
+	p.pools[class].Put(&b)
+}
+
+// PlausibleTs returns whether ts is a plausible version of a key written by now, allowing for a
+// clock skew of up to maxSkew. ts is compared with now as nanoseconds since the unix epoch, the
+// finest resolution versions are taken from, so that logical timestamps, as assigned by Badger,
+// and wall clock ones are plausible, while corrupted or byte swapped ones tend to be far in the
+// future. Keys are never written at ts 0, so it's not plausible either.
+func PlausibleTs(ts uint64, now time.Time, maxSkew time.Duration) bool {
+	if ts == 0 {
+		return false
+	}
+	limit := now.Add(maxSkew).UnixNano()
+	return limit > 0 && ts <= uint64(limit)
+}
+
+// EncodeExpiry returns the expiry of an entry expiring at t, in seconds since the unix epoch. The
+// zero time is encoded as 0, meaning that the entry never expires. Times up to the epoch are
+// encoded as 1, so that they're still expired.
+func EncodeExpiry(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	if sec := t.Unix(); sec > 0 {
+		return uint64(sec)
+	}
+	return 1
+}
+
+// IsExpired returns whether an entry with the given expiry, as encoded by EncodeExpiry, has
+// expired at now. An expiry of 0 never expires, and an entry expires at the start of its expiry
+// second.
+func IsExpired(expiry uint64, now time.Time) bool {
+	if expiry == 0 {
+		return false
+	}
+	return expiry <= uint64(now.Unix())
+}
+
 // FixedDuration returns a string representation of the given duration with the
-// hours, minutes, and seconds.
+// hours, minutes, and seconds. Negative durations are prefixed with "-".
 func FixedDuration(d time.Duration) string {
+	if d < 0 {
+		if d = -d; d < 0 {
+			d = math.MaxInt64 // -d overflowed.
+		}
+		return "-" + FixedDuration(d)
+	}
 	str := fmt.Sprintf("%02ds", int(d.Seconds())%60)
 	if d >= time.Minute {
 		str = fmt.Sprintf("%02dm", int(d.Minutes())%60) + str
@@ -193,6 +769,40 @@ func FixedDuration(d time.Duration) string {
 	return str
 }
 
+// HumanBytes returns a string representation of n bytes in binary units, with at most one
+// decimal place. For example, HumanBytes(1536) returns "1.5 KiB". Unlike humanize.IBytes and
+// IBytesToString, it handles negative sizes, and picks the unit after rounding, so that
+// HumanBytes(1<<20-1) returns "1 MiB" rather than "1024 KiB".
+func HumanBytes(n int64) string {
+	return humanBytes(n, 1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"})
+}
+
+// HumanBytesSI is like HumanBytes, but uses decimal (SI) units. For example,
+// HumanBytesSI(1500) returns "1.5 KB".
+func HumanBytesSI(n int64) string {
+	return humanBytes(n, 1000, []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"})
+}
+
+func humanBytes(n int64, base uint64, units []string) string {
+	sign := ""
+	u := uint64(n)
+	if n < 0 {
+		sign = "-"
+		u = uint64(-n) // Also correct for math.MinInt64.
+	}
+	if u < base {
+		return fmt.Sprintf("%s%d %s", sign, u, units[0])
+	}
+	div, exp := float64(base), 1
+	round := func() float64 { return math.Round(float64(u)/div*10) / 10 }
+	// Move to the next unit if the value reaches base once rounded.
+	for round() >= float64(base) && exp < len(units)-1 {
+		div *= float64(base)
+		exp++
+	}
+	return fmt.Sprintf("%s%s %s", sign, humanize.FtoaWithDigits(round(), 1), units[exp])
+}
+
 // Throttle allows a limited number of workers to run at a time. It also
 // provides a mechanism to check for errors encountered by workers and wait for
 // them to finish.
@@ -202,6 +812,11 @@ type Throttle struct {
 	ch        chan struct{}
 	errCh     chan error
 	finishErr error
+
+	errMu sync.Mutex
+	errs  []error // All errors passed to Done, in order of receipt.
+
+	onWait func(d time.Duration)
 }
 
 // NewThrottle creates a new throttle with a max number of workers.
@@ -212,14 +827,29 @@ func NewThrottle(max int) *Throttle {
 	}
 }
 
+// NewThrottleWithObserver creates a new throttle with a max number of workers, like NewThrottle.
+// Every time Do lets a worker start, onWait is called with the duration Do blocked for.
+func NewThrottleWithObserver(max int, onWait func(d time.Duration)) *Throttle {
+	t := NewThrottle(max)
+	t.onWait = onWait
+	return t
+}
+
 // Do should be called by workers before they start working. It blocks if there
 // are already maximum number of workers working. If it detects an error from
 // previously Done workers, it would return it.
 func (t *Throttle) Do() error {
+	var start time.Time
+	if t.onWait != nil {
+		start = time.Now()
+	}
 	for {
 		select {
 		case t.ch <- struct{}{}:
 			t.wg.Add(1)
+			if t.onWait != nil {
+				t.onWait(time.Since(start))
+			}
 			return nil
 		case err := <-t.errCh:
 			if err != nil {
@@ -229,20 +859,49 @@ func (t *Throttle) Do() error {
 	}
 }
 
+// TryDo is a non-blocking Do. It returns true if a worker may start working, in which case Done
+// must be called as with Do. It returns false if there are already maximum number of workers
+// working. Unlike Do, it doesn't check for errors from previously Done workers.
+func (t *Throttle) TryDo() bool {
+	select {
+	case t.ch <- struct{}{}:
+		t.wg.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
 // Done should be called by workers when they finish working. They can also
-// pass the error status of work done.
+// pass the error status of work done. It panics with ErrThrottleMismatch if there
+// is no matching call to Do.
 func (t *Throttle) Done(err error) {
 	if err != nil {
+		t.errMu.Lock()
+		t.errs = append(t.errs, err)
+		t.errMu.Unlock()
 		t.errCh <- err
 	}
 	select {
 	case <-t.ch:
 	default:
-		panic("Throttle Do Done mismatch")
+		panic(ErrThrottleMismatch)
 	}
 	t.wg.Done()
 }
 
+// HasError returns true if an error passed by Done is pending, i.e. it hasn't been returned by Do
+// or Finish yet. It doesn't consume the error.
+func (t *Throttle) HasError() bool {
+	return len(t.errCh) > 0
+}
+
+// Errors returns the number of errors passed by Done which are pending, i.e. haven't been returned
+// by Do or Finish yet. It doesn't consume them.
+func (t *Throttle) Errors() int {
+	return len(t.errCh)
+}
+
 // Finish waits until all workers have finished working. It would return any error passed by Done.
 // If Finish is called multiple time, it will wait for workers to finish only once(first time).
 // From next calls, it will return same error as found on first call.
@@ -262,6 +921,39 @@ func (t *Throttle) Finish() error {
 	return t.finishErr
 }
 
+// FinishWithWatchdog waits until all workers have finished working, like Finish. While waiting,
+// it calls onStall with the number of workers still running every time the given interval
+// elapses, so that a worker which never calls Done gets noticed.
+func (t *Throttle) FinishWithWatchdog(every time.Duration, onStall func(running int)) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Finish()
+	}()
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			onStall(len(t.ch))
+		}
+	}
+}
+
+// FinishAll waits until all workers have finished working, like Finish. It returns all errors
+// passed by Done, in the order they were received, including the ones already returned by Do.
+func (t *Throttle) FinishAll() []error {
+	t.Finish()
+
+	t.errMu.Lock()
+	defer t.errMu.Unlock()
+	errs := make([]error, len(t.errs))
+	copy(errs, t.errs)
+	return errs
+}
+
 // U32ToBytes converts the given Uint32 to bytes
 func U32ToBytes(v uint32) []byte {
 	var uBuf [4]byte
@@ -300,6 +992,21 @@ func BytesToU32Slice(b []byte) []uint32 {
 	return u32s
 }
 
+// SearchU32 returns the index of the first element of s, sorted in increasing order, which is
+// greater than or equal to target, or len(s) if there's none. It works on the uint32 slices
+// returned by BytesToU32Slice, like sort.SearchInts does on int slices.
+func SearchU32(s []uint32, target uint32) int {
+	return sort.Search(len(s), func(i int) bool { return s[i] >= target })
+}
+
+// SearchOffsets returns the smallest index i in [0, len(s)) for which pred(i) is true, or len(s)
+// if there's none, like sort.Search does. pred must be false for some prefix of s and true for
+// the rest of it. It's meant for searches over the offsets in s which compare the data they
+// point to, e.g. the keys of a block.
+func SearchOffsets(s []uint32, pred func(i int) bool) int {
+	return sort.Search(len(s), pred)
+}
+
 // U64ToBytes converts the given Uint64 to bytes
 func U64ToBytes(v uint64) []byte {
 	var uBuf [8]byte
@@ -338,6 +1045,10 @@ func BytesToU64Slice(b []byte) []uint64 {
 	return u64s
 }
 
+// defaultPageSize is the size of the first page of a zero value PageBuffer, or of one created with
+// a non-positive page size.
+const defaultPageSize = 512
+
 // page struct contains one underlying buffer.
 type page struct {
 	buf []byte
@@ -347,24 +1058,93 @@ type page struct {
 // replacement of bytes.Buffer. Instead of having single underlying buffer, it has multiple
 // underlying buffers. Hence it avoids any copy during relocation(as happens in bytes.Buffer).
 // PageBuffer allocates memory in pages. Once a page is full, it will allocate page with double the
-// size of previous page. Its function are not thread safe.
+// size of previous page. The zero value is an empty PageBuffer ready to use. Its function are not
+// thread safe.
 type PageBuffer struct {
 	pages []*page
 
-	length       int // Length of PageBuffer.
-	nextPageSize int // Size of next page to be allocated.
+	length       int     // Length of PageBuffer.
+	nextPageSize int     // Size of next page to be allocated.
+	maxPageSize  int     // Max size of a page. Zero means unbounded.
+	growthFactor float64 // Factor by which page sizes grow. Zero means doubling.
+
+	checksum bool   // Whether crc is maintained as data is written.
+	crc      uint32 // CRC32C of the data, if crcValid.
+	crcValid bool   // Whether crc covers all the data. Only set if checksum is enabled.
+
+	frozen bool // Whether b is immutable, see Freeze.
 }
 
-// NewPageBuffer returns a new PageBuffer with first page having size pageSize.
+// NewPageBuffer returns a new PageBuffer with first page having size pageSize. A non-positive
+// pageSize is replaced by a default page size, as pages must be able to hold some data.
 func NewPageBuffer(pageSize int) *PageBuffer {
 	b := &PageBuffer{}
-	b.pages = append(b.pages, &page{buf: make([]byte, 0, pageSize)})
-	b.nextPageSize = pageSize * 2
+	b.init(pageSize)
+	return b
+}
+
+// NewPageBufferWithMax returns a new PageBuffer like NewPageBuffer, whose pages don't grow beyond
+// maxPageSize. Once pages reach maxPageSize, PageBuffer grows by allocating pages of that size.
+// This bounds the size of a single allocation when writing large amounts of data.
+func NewPageBufferWithMax(pageSize, maxPageSize int) *PageBuffer {
+	b := &PageBuffer{maxPageSize: maxPageSize}
+	b.init(pageSize)
+	return b
+}
+
+// NewPageBufferWithGrowth returns a new PageBuffer like NewPageBuffer, whose pages grow by factor
+// instead of doubling. A smaller factor reduces the memory wasted by the last page, at the cost of
+// more allocations. factor must be greater than 1.
+func NewPageBufferWithGrowth(pageSize int, factor float64) *PageBuffer {
+	AssertTruef(factor > 1, "PageBuffer growth factor must be greater than 1, got: %f", factor)
+	b := &PageBuffer{growthFactor: factor}
+	b.init(pageSize)
+	return b
+}
+
+// NewPageBufferWithChecksum returns a new PageBuffer like NewPageBuffer, which maintains a running
+// CRC32C checksum of its data as it's written. This avoids a second pass over the data to compute
+// its checksum with Checksum.
+func NewPageBufferWithChecksum(pageSize int) *PageBuffer {
+	b := &PageBuffer{checksum: true, crcValid: true}
+	b.init(pageSize)
 	return b
 }
 
+// init allocates the first page of b with size pageSize.
+func (b *PageBuffer) init(pageSize int) {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if b.maxPageSize > 0 && pageSize > b.maxPageSize {
+		pageSize = b.maxPageSize
+	}
+	b.pages = append(b.pages, &page{buf: make([]byte, 0, pageSize)})
+	b.nextPageSize = pageSize
+	b.growPageSize()
+}
+
+// growPageSize grows the size of next page to be allocated by growthFactor, up to maxPageSize.
+func (b *PageBuffer) growPageSize() {
+	if b.growthFactor == 0 {
+		b.nextPageSize *= 2
+	} else if next := int(float64(b.nextPageSize) * b.growthFactor); next > b.nextPageSize {
+		b.nextPageSize = next
+	} else {
+		b.nextPageSize++ // Small pages need to grow too.
+	}
+	if b.maxPageSize > 0 && b.nextPageSize > b.maxPageSize {
+		b.nextPageSize = b.maxPageSize
+	}
+}
+
 // Write writes data to PageBuffer b. It returns number of bytes written and any error encountered.
 func (b *PageBuffer) Write(data []byte) (int, error) {
+	b.checkNotFrozen()
+	if len(b.pages) == 0 {
+		b.init(defaultPageSize)
+	}
+	b.updateChecksum(data)
 	dataLen := len(data)
 	for {
 		cp := b.pages[len(b.pages)-1] // Current page.
@@ -379,23 +1159,234 @@ func (b *PageBuffer) Write(data []byte) (int, error) {
 		data = data[n:]
 
 		b.pages = append(b.pages, &page{buf: make([]byte, 0, b.nextPageSize)})
-		b.nextPageSize *= 2
+		b.growPageSize()
 	}
 
 	return dataLen, nil
 }
 
+// ReadFrom reads data from r until EOF and appends it to PageBuffer b, implementing
+// io.ReaderFrom. It reads directly into the pages of b, allocating new pages as needed. It returns
+// the number of bytes read, and any error encountered other than io.EOF.
+func (b *PageBuffer) ReadFrom(r io.Reader) (int64, error) {
+	b.checkNotFrozen()
+	if len(b.pages) == 0 {
+		b.init(defaultPageSize)
+	}
+	var read int64
+	for {
+		cp := b.pages[len(b.pages)-1] // Current page.
+		if len(cp.buf) == cap(cp.buf) {
+			b.pages = append(b.pages, &page{buf: make([]byte, 0, b.nextPageSize)})
+			b.growPageSize()
+			continue
+		}
+
+		n, err := r.Read(cp.buf[len(cp.buf):cap(cp.buf)])
+		b.updateChecksum(cp.buf[len(cp.buf) : len(cp.buf)+n])
+		cp.buf = cp.buf[:len(cp.buf)+n]
+		b.length += n
+		read += int64(n)
+		if err == io.EOF {
+			return read, nil
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
 // WriteByte writes data byte to PageBuffer and returns any encountered error.
 func (b *PageBuffer) WriteByte(data byte) error {
 	_, err := b.Write([]byte{data})
 	return err
 }
 
+// AppendBuffer appends the contents of other to b without copying any data, by moving the pages of
+// other to b. After the call other is empty, and readers created on other must not be used.
+func (b *PageBuffer) AppendBuffer(other *PageBuffer) {
+	if other == b {
+		return
+	}
+	b.checkNotFrozen()
+	other.checkNotFrozen()
+	b.pages = append(b.pages, other.pages...)
+	b.length += other.length
+	b.crcValid = false
+	if other.nextPageSize > b.nextPageSize {
+		b.nextPageSize = other.nextPageSize
+		if b.maxPageSize > 0 && b.nextPageSize > b.maxPageSize {
+			b.nextPageSize = b.maxPageSize
+		}
+	}
+	*other = PageBuffer{
+		maxPageSize:  other.maxPageSize,
+		growthFactor: other.growthFactor,
+		checksum:     other.checksum,
+		crcValid:     other.checksum,
+	}
+}
+
+// WriteAt overwrites the bytes of PageBuffer b starting at offset off with p, implementing
+// io.WriterAt. It can only patch data written earlier, so it returns an error without writing
+// anything if the write would extend past the length of b.
+func (b *PageBuffer) WriteAt(p []byte, off int64) (int, error) {
+	b.checkNotFrozen()
+	if off < 0 || off+int64(len(p)) > int64(b.length) {
+		return 0, errors.Errorf("WriteAt offset: %d, length: %d out of range [0, %d]",
+			off, len(p), b.length)
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	b.crcValid = false
+	pageIdx, startIdx := b.pageForOffset(int(off))
+	written := 0
+	for written < len(p) {
+		cp := b.pages[pageIdx]
+		written += copy(cp.buf[startIdx:], p[written:])
+		pageIdx++
+		startIdx = 0
+	}
+	return written, nil
+}
+
+// InsertAt inserts p into PageBuffer b at offset off, shifting the data after off, which must be
+// within [0, b.Len()], to the right. It copies all the data after off, so it takes O(b.Len()-off)
+// time.
+func (b *PageBuffer) InsertAt(off int, p []byte) {
+	b.checkNotFrozen()
+	AssertTruef(off >= 0 && off <= b.length, "InsertAt offset: %d out of range [0, %d]",
+		off, b.length)
+	if off == b.length {
+		b.Write(p)
+		return
+	}
+	tail := make([]byte, b.length-off)
+	_, err := b.ReadAt(tail, int64(off))
+	Check(err)
+	b.Truncate(off)
+	b.Write(p)
+	b.Write(tail)
+}
+
+// WriteUvarint writes x to PageBuffer b in varint encoding. It returns the number of bytes written.
+func (b *PageBuffer) WriteUvarint(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	b.Write(buf[:n])
+	return n
+}
+
+// WriteFrame writes payload to PageBuffer b as a frame, i.e. prefixed by its length in varint
+// encoding. Frames can be read back using NextFrame. It returns the number of bytes written.
+func (b *PageBuffer) WriteFrame(payload []byte) int {
+	n := b.WriteUvarint(uint64(len(payload)))
+	b.Write(payload)
+	return n + len(payload)
+}
+
+// Clone returns a deep copy of PageBuffer b, which isn't affected by later changes to b and vice
+// versa. The copy isn't frozen, even if b is.
+func (b *PageBuffer) Clone() *PageBuffer {
+	c := &PageBuffer{
+		pages:        make([]*page, 0, len(b.pages)),
+		length:       b.length,
+		nextPageSize: b.nextPageSize,
+		maxPageSize:  b.maxPageSize,
+		growthFactor: b.growthFactor,
+		checksum:     b.checksum,
+		crc:          b.crc,
+		crcValid:     b.crcValid,
+	}
+	for _, p := range b.pages {
+		buf := make([]byte, len(p.buf), cap(p.buf))
+		copy(buf, p.buf)
+		c.pages = append(c.pages, &page{buf: buf})
+	}
+	return c
+}
+
 // Len returns length of PageBuffer.
 func (b *PageBuffer) Len() int {
 	return b.length
 }
 
+// Cap returns the total capacity of the pages of PageBuffer.
+func (b *PageBuffer) Cap() int {
+	c := 0
+	for _, p := range b.pages {
+		c += cap(p.buf)
+	}
+	return c
+}
+
+// Reset resets PageBuffer to be empty. It retains the first page for future writes, and releases
+// the other pages.
+func (b *PageBuffer) Reset() {
+	b.checkNotFrozen()
+	if len(b.pages) == 0 {
+		return
+	}
+	for i := 1; i < len(b.pages); i++ {
+		b.pages[i] = nil
+	}
+	b.pages = b.pages[:1]
+	b.pages[0].buf = b.pages[0].buf[:0]
+	b.length = 0
+	b.nextPageSize = cap(b.pages[0].buf)
+	if b.nextPageSize == 0 {
+		// Growing a zero page size would never allocate room to write to.
+		b.nextPageSize = defaultPageSize
+	}
+	b.growPageSize()
+	b.crc, b.crcValid = 0, b.checksum
+}
+
+// Freeze marks PageBuffer b as immutable. Any later call modifying b panics with
+// ErrPageBufferFrozen. Once frozen, b can be read concurrently by multiple goroutines, e.g. via
+// Len, Bytes, ReadAt, WriteTo, ForEachPage, Checksum, and independent readers created by
+// NewReaderAt. Freeze itself must not be called concurrently with other calls on b.
+func (b *PageBuffer) Freeze() {
+	if b.checksum {
+		// Compute the checksum now, so that Checksum doesn't modify b later.
+		b.Checksum()
+	}
+	b.frozen = true
+}
+
+// checkNotFrozen panics with ErrPageBufferFrozen if PageBuffer b has been frozen.
+func (b *PageBuffer) checkNotFrozen() {
+	if b.frozen {
+		panic(ErrPageBufferFrozen)
+	}
+}
+
+// updateChecksum extends the running checksum of PageBuffer b with data appended to it.
+func (b *PageBuffer) updateChecksum(data []byte) {
+	if b.crcValid {
+		b.crc = crc32.Update(b.crc, CastagnoliCrcTable, data)
+	}
+}
+
+// Checksum returns the CRC32C checksum of the data in PageBuffer b. For a PageBuffer created with
+// NewPageBufferWithChecksum, it's maintained as data is written, and only recomputed after data is
+// modified in place, e.g. via WriteAt or Truncate. Otherwise, it's computed over all the data.
+func (b *PageBuffer) Checksum() uint32 {
+	if b.crcValid {
+		return b.crc
+	}
+	var crc uint32
+	for _, p := range b.pages {
+		crc = crc32.Update(crc, CastagnoliCrcTable, p.buf)
+	}
+	if b.checksum {
+		b.crc, b.crcValid = crc, true
+	}
+	return crc
+}
+
 // pageForOffset returns pageIdx and startIdx for the offset.
 func (b *PageBuffer) pageForOffset(offset int) (int, int) {
 	AssertTrue(offset < b.length)
@@ -418,12 +1409,14 @@ func (b *PageBuffer) pageForOffset(offset int) (int, int) {
 
 // Truncate truncates PageBuffer to length n.
 func (b *PageBuffer) Truncate(n int) {
+	b.checkNotFrozen()
 	pageIdx, startIdx := b.pageForOffset(n)
 	// For simplicity of the code reject extra pages. These pages can be kept.
 	b.pages = b.pages[:pageIdx+1]
 	cp := b.pages[len(b.pages)-1]
 	cp.buf = cp.buf[:startIdx]
 	b.length = n
+	b.crcValid = false
 }
 
 // Bytes returns whole Buffer data as single []byte.
@@ -451,6 +1444,228 @@ func (b *PageBuffer) WriteTo(w io.Writer) (int64, error) {
 	return written, nil
 }
 
+// Persist writes the data of PageBuffer b to a new file at path, created by CreateSyncedFile, so
+// it fails if the file already exists. If sync is true, the file is fsynced before being closed.
+// On failure, the partially written file is removed.
+func (b *PageBuffer) Persist(path string, sync bool) error {
+	f, err := CreateSyncedFile(path, sync)
+	if err != nil {
+		return Wrapf(err, "While creating file: %s", path)
+	}
+	fail := func(err error, format string) error {
+		f.Close()
+		os.Remove(path)
+		return Wrapf(err, format, path)
+	}
+	if _, err := b.WriteTo(f); err != nil {
+		return fail(err, "While writing to file: %s")
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			return fail(err, "While syncing file: %s")
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return Wrapf(err, "While closing file: %s", path)
+	}
+	return nil
+}
+
+// Drain writes the data of PageBuffer b to w in pieces of up to chunk bytes, removing it from b as
+// it goes, so that the memory of pages is released once they're written. A non-positive chunk
+// writes whole pages at once. It returns the number of bytes written. On error, b holds the data
+// which wasn't written yet. Readers created on b must not be used afterwards.
+func (b *PageBuffer) Drain(w io.Writer, chunk int) (int64, error) {
+	b.checkNotFrozen()
+	b.crcValid = false
+	var written int64
+	for len(b.pages) > 0 {
+		cp := b.pages[0]
+		full := cp.buf
+		for len(cp.buf) > 0 {
+			n := len(cp.buf)
+			if chunk > 0 && chunk < n {
+				n = chunk
+			}
+			nw, err := w.Write(cp.buf[:n])
+			cp.buf = cp.buf[nw:]
+			b.length -= nw
+			written += int64(nw)
+			if err == nil && nw < n {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+		if len(b.pages) == 1 {
+			// Keep the last page, reusing all of its capacity for later writes.
+			cp.buf = full[:0]
+			break
+		}
+		b.pages[0] = nil
+		b.pages = b.pages[1:]
+	}
+	return written, nil
+}
+
+// ForEachPage calls fn with the data of each non-empty page of PageBuffer b in order, without
+// copying it. It stops at the first error returned by fn and returns it. fn must not modify or
+// retain the slice it's passed.
+func (b *PageBuffer) ForEachPage(fn func(p []byte) error) error {
+	for _, p := range b.pages {
+		if len(p.buf) == 0 {
+			continue
+		}
+		if err := fn(p.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Equal returns whether PageBuffers b and other hold the same data. The buffers are compared page
+// by page, without copying them, so their pages don't need to have the same sizes.
+func (b *PageBuffer) Equal(other *PageBuffer) bool {
+	if b.length != other.length {
+		return false
+	}
+	var i, j int      // Indices of the current pages of b and other.
+	var bp, op []byte // Remaining data of the current pages of b and other.
+	for {
+		for len(bp) == 0 && i < len(b.pages) {
+			bp = b.pages[i].buf
+			i++
+		}
+		for len(op) == 0 && j < len(other.pages) {
+			op = other.pages[j].buf
+			j++
+		}
+		if len(bp) == 0 || len(op) == 0 {
+			// Both buffers have the same length, so both are exhausted.
+			return true
+		}
+		n := len(bp)
+		if len(op) < n {
+			n = len(op)
+		}
+		if !bytes.Equal(bp[:n], op[:n]) {
+			return false
+		}
+		bp, op = bp[n:], op[n:]
+	}
+}
+
+// ReadAt reads len(p) bytes from PageBuffer b starting at offset off, implementing io.ReaderAt.
+// It returns io.EOF if fewer than len(p) bytes are available. Unlike the readers returned by
+// NewReaderAt, it doesn't keep any state, so concurrent calls are safe as long as b isn't being
+// modified, e.g. after Freeze.
+func (b *PageBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.Errorf("ReadAt negative offset: %d", off)
+	}
+	if off >= int64(b.length) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	pageIdx, startIdx := b.pageForOffset(int(off))
+	read := 0
+	for read < len(p) && pageIdx < len(b.pages) {
+		read += copy(p[read:], b.pages[pageIdx].buf[startIdx:])
+		pageIdx++
+		startIdx = 0
+	}
+	if read < len(p) {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// SearchFrames binary searches the frames of PageBuffer b, as written by WriteFrame, for a record
+// for which cmp(record, target) returns 0. The frames must be sorted in the order defined by cmp,
+// which returns a negative value if record sorts before target and a positive one if it sorts
+// after it. It returns a copy of the record, and whether one was found. It returns false if b
+// holds malformed frames.
+//
+// Frames have variable lengths, so each call first scans all of b to find where the frames start,
+// which takes time linear in the number of frames. To search b more than once, build a FrameIndex
+// using IndexFrames and search that instead.
+func (b *PageBuffer) SearchFrames(target []byte, cmp func(rec, target []byte) int) ([]byte, bool) {
+	fi, err := b.IndexFrames()
+	if err != nil {
+		return nil, false
+	}
+	return fi.Search(target, cmp)
+}
+
+// FrameIndex holds where each frame of a PageBuffer starts, so that the frames can be binary
+// searched without scanning the buffer every time. It is only valid as long as the PageBuffer
+// isn't modified, e.g. after Freeze.
+type FrameIndex struct {
+	b     *PageBuffer
+	offs  []int64 // Offsets of the payloads.
+	sizes []int
+}
+
+// IndexFrames scans the frames of PageBuffer b, as written by WriteFrame, and returns a FrameIndex
+// over them. It returns an error if b holds malformed frames.
+func (b *PageBuffer) IndexFrames() (*FrameIndex, error) {
+	fi := &FrameIndex{b: b}
+	if b.length == 0 {
+		return fi, nil
+	}
+	r := b.NewReaderAt(0)
+	for off := int64(0); off < int64(b.length); {
+		sz, n, err := ReadUvarint(r)
+		if err != nil {
+			return nil, Wrapf(err, "While reading frame length at offset: %d", off)
+		}
+		if sz > uint64(b.length)-uint64(off)-uint64(n) {
+			return nil, errors.Errorf("Frame length: %d at offset: %d exceeds the buffer length: %d",
+				sz, off, b.length)
+		}
+		fi.offs = append(fi.offs, off+int64(n))
+		fi.sizes = append(fi.sizes, int(sz))
+		next, err := r.Seek(int64(sz), io.SeekCurrent)
+		if err != nil {
+			return nil, Wrapf(err, "While skipping frame at offset: %d", off)
+		}
+		off = next
+	}
+	return fi, nil
+}
+
+// Len returns the number of frames in FrameIndex fi.
+func (fi *FrameIndex) Len() int {
+	return len(fi.offs)
+}
+
+// Search binary searches the frames indexed by fi, like PageBuffer.SearchFrames, but only reads
+// the payloads compared by the search.
+func (fi *FrameIndex) Search(target []byte, cmp func(rec, target []byte) int) ([]byte, bool) {
+	lo, hi := 0, len(fi.offs)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		rec := make([]byte, fi.sizes[mid])
+		if _, err := fi.b.ReadAt(rec, fi.offs[mid]); err != nil {
+			return nil, false
+		}
+		switch c := cmp(rec, target); {
+		case c == 0:
+			return rec, true
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return nil, false
+}
+
 // NewReaderAt returns a reader which starts reading from offset in page buffer.
 func (b *PageBuffer) NewReaderAt(offset int) *PageBufferReader {
 	pageIdx, startIdx := b.pageForOffset(offset)
@@ -483,18 +1698,17 @@ func (r *PageBufferReader) Read(p []byte) (int, error) {
 		read += n
 		r.startIdx += n
 
-		// Instead of len(cp.buf), we comparing with cap(cp.buf). This ensures that we move to next
-		// page only when we have read all data. Reading from last page is an edge case. We don't
-		// want to move to next page until last page is full to its capacity.
-		if r.startIdx >= cap(cp.buf) {
+		// Pages other than the last one need not be full to their capacity (see AppendBuffer), so we
+		// move to next page once we have read all data up to its length. Reading from last page is
+		// an edge case. We don't move past it, so that data written to it later can still be read.
+		if r.startIdx >= len(cp.buf) && r.pageIdx < pc-1 {
 			// We should move to next page.
 			r.pageIdx++
 			r.startIdx = 0
 			continue
 		}
 
-		// When last page in not full to its capacity and we have read all data up to its
-		// length, just break out of the loop.
+		// When we have read all data up to the length of last page, just break out of the loop.
 		if r.pageIdx == pc-1 {
 			break
 		}
@@ -507,6 +1721,205 @@ func (r *PageBufferReader) Read(p []byte) (int, error) {
 	return read, nil
 }
 
+// WriteTo writes the data left to read to w, page by page, implementing io.WriterTo. Like Read, it
+// leaves the reader at the end of the last page, so that data written to it later can still be
+// read. It returns the number of bytes written and any error encountered.
+func (r *PageBufferReader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	pc := len(r.buf.pages)
+	for r.pageIdx < pc {
+		if data := r.buf.pages[r.pageIdx].buf[r.startIdx:]; len(data) > 0 {
+			n, err := w.Write(data)
+			written += int64(n)
+			r.startIdx += n
+			if err == nil && n < len(data) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+		if r.pageIdx == pc-1 {
+			break
+		}
+		r.pageIdx++
+		r.startIdx = 0
+	}
+	return written, nil
+}
+
+// Seek sets the offset for the next Read to offset, interpreted according to whence as described
+// by io.Seeker. It returns the new offset relative to the start of the buffer. Seeking before the
+// start or past the end of the buffer is an error.
+func (r *PageBufferReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = int64(r.offset()) + offset
+	case io.SeekEnd:
+		abs = int64(r.buf.length) + offset
+	default:
+		return 0, errors.Errorf("Invalid whence: %d", whence)
+	}
+	if abs < 0 || abs > int64(r.buf.length) {
+		return 0, errors.Errorf("Seek offset: %d out of range [0, %d]", abs, r.buf.length)
+	}
+
+	if abs < int64(r.buf.length) {
+		r.pageIdx, r.startIdx = r.buf.pageForOffset(int(abs))
+		return abs, nil
+	}
+	// Seek to the end of last page, so that data written later can still be read.
+	r.pageIdx, r.startIdx = 0, 0
+	if pc := len(r.buf.pages); pc > 0 {
+		r.pageIdx, r.startIdx = pc-1, len(r.buf.pages[pc-1].buf)
+	}
+	return abs, nil
+}
+
+// offset returns the offset of the next Read relative to the start of the buffer.
+func (r *PageBufferReader) offset() int {
+	offset := r.startIdx
+	for i := 0; i < r.pageIdx && i < len(r.buf.pages); i++ {
+		offset += len(r.buf.pages[i].buf)
+	}
+	return offset
+}
+
+// ReadByte reads a single byte. It returns io.EOF if there is nothing left to read.
+func (r *PageBufferReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := r.Read(b[:])
+	return b[0], err
+}
+
+var errUvarintOverflow = errors.New("varint overflows a 64-bit integer")
+
+// ReadUvarint reads a varint encoded uint64 from r, as written by PageBuffer.WriteUvarint. It
+// returns the value along with the number of bytes read. If r ends before the varint does, the
+// error is io.EOF if no bytes were read and io.ErrUnexpectedEOF otherwise.
+func ReadUvarint(r io.ByteReader) (uint64, int, error) {
+	var x uint64
+	var s uint
+	for i := 0; i < binary.MaxVarintLen64; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return x, i, err
+		}
+		if c < 0x80 {
+			if i == binary.MaxVarintLen64-1 && c > 1 {
+				return x, i + 1, errUvarintOverflow
+			}
+			return x | uint64(c)<<s, i + 1, nil
+		}
+		x |= uint64(c&0x7f) << s
+		s += 7
+	}
+	return x, binary.MaxVarintLen64, errUvarintOverflow
+}
+
+// PageBufferPool is a pool of PageBuffers, which allows reusing them across users. It's safe for
+// concurrent use.
+type PageBufferPool struct {
+	pool   sync.Pool
+	maxCap int
+}
+
+// NewPageBufferPool returns a new PageBufferPool handing out PageBuffers with first page having
+// size pageSize. PageBuffers whose capacity exceeds maxCap are not returned to the pool on Put, so
+// that a few large buffers don't pin memory. A non-positive maxCap means all PageBuffers are
+// retained.
+func NewPageBufferPool(pageSize, maxCap int) *PageBufferPool {
+	return &PageBufferPool{
+		pool: sync.Pool{
+			New: func() interface{} { return NewPageBuffer(pageSize) },
+		},
+		maxCap: maxCap,
+	}
+}
+
+// Get returns an empty PageBuffer from the pool, allocating a new one if needed.
+func (p *PageBufferPool) Get() *PageBuffer {
+	return p.pool.Get().(*PageBuffer)
+}
+
+// Put resets b and returns it to the pool. b must not be used after calling Put.
+func (p *PageBufferPool) Put(b *PageBuffer) {
+	if p.maxCap > 0 && b.Cap() > p.maxCap {
+		return
+	}
+	b.Reset()
+	p.pool.Put(b)
+}
+
+// maxFrameSize is the largest frame payload NextFrame accepts, and the longest key suffix
+// PrefixDeltaReader accepts. Larger lengths come from corrupt data.
+const maxFrameSize = 1 << 30
+
+// readChunkSize is the size of the chunks readBounded grows its buffer by.
+const readChunkSize = 64 << 10
+
+// NextFrame reads the next frame written by PageBuffer.WriteFrame from r, and returns its payload.
+// It returns io.EOF if r has no more frames, and io.ErrUnexpectedEOF if r ends within a frame. It
+// returns an error for frames larger than maxFrameSize, which can only come from corrupt data.
+func NextFrame(r io.Reader) ([]byte, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	sz, _, err := ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if sz > maxFrameSize {
+		return nil, errors.Errorf("Frame length: %d exceeds the limit: %d", sz, maxFrameSize)
+	}
+	return readBounded(nil, r, int(sz))
+}
+
+// readBounded reads exactly sz bytes from r, and appends them to buf. It grows buf as data arrives,
+// in chunks of readChunkSize, so that a corrupt length doesn't allocate more memory than r holds.
+// It returns io.ErrUnexpectedEOF if r ends early.
+func readBounded(buf []byte, r io.Reader, sz int) ([]byte, error) {
+	for end := len(buf) + sz; len(buf) < end; {
+		n := end - len(buf)
+		if n > readChunkSize {
+			n = readChunkSize
+		}
+		start := len(buf)
+		buf = append(buf, make([]byte, n)...)
+		if _, err := io.ReadFull(r, buf[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	return buf, nil
+}
+
+// byteReader implements io.ByteReader over an io.Reader, without any buffering, so that r can
+// still be read from after reading some bytes through byteReader.
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(br.r, br.buf[:]); err != nil {
+		return 0, err
+	}
+	return br.buf[0], nil
+}
+
 const kvsz = int(unsafe.Sizeof(pb.KV{}))
 
 func NewKV(alloc *z.Allocator) *pb.KV {
@@ -3,9 +3,18 @@ package y
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,6 +48,130 @@ func BenchmarkBuffer(b *testing.B) {
 	})
 }
 
+func TestSafeCopyInto(t *testing.T) {
+	src := []byte("foobar")
+
+	// Nil dst.
+	out := SafeCopyInto(nil, src)
+	require.Equal(t, src, out)
+	require.False(t, overlaps(out, src))
+
+	// dst smaller than src is not reused.
+	dst := make([]byte, 2)
+	out = SafeCopyInto(dst, src)
+	require.Equal(t, src, out)
+	require.False(t, overlaps(out, dst))
+	require.False(t, overlaps(out, src))
+
+	// dst larger than src is reused.
+	dst = make([]byte, 16)
+	out = SafeCopyInto(dst, src)
+	require.Equal(t, src, out)
+	require.True(t, overlaps(out, dst))
+	require.False(t, overlaps(out, src))
+	require.Zero(t, testing.AllocsPerRun(100, func() { out = SafeCopyInto(dst, src) }))
+	dst = make([]byte, 2)
+	require.Equal(t, float64(1), testing.AllocsPerRun(100, func() { out = SafeCopyInto(dst, src) }))
+
+	// Mutating src doesn't affect the copy.
+	out = SafeCopyInto(nil, src)
+	src[0] = 'g'
+	require.Equal(t, "foobar", string(out))
+	src[0] = 'f'
+	require.Empty(t, SafeCopyInto(dst, nil))
+
+	// dst sharing memory with src is not reused.
+	buf := []byte("xxfoobar")
+	out = SafeCopyInto(buf, buf[2:])
+	require.Equal(t, src, out)
+	require.False(t, overlaps(out, buf))
+	require.Equal(t, []byte("xxfoobar"), buf)
+
+	// SafeCopy on the other hand reuses dst, modifying the shared memory.
+	out = SafeCopy(buf, buf[2:])
+	require.Equal(t, src, out)
+	require.True(t, overlaps(out, buf))
+}
+
+func TestTsSuffix(t *testing.T) {
+	for _, ts := range []uint64{0, 1, 255, 256, 1 << 32, math.MaxUint64 - 1, math.MaxUint64} {
+		suffix := EncodeTsSuffix(ts)
+		require.Equal(t, ts, DecodeTsSuffix(suffix))
+
+		key := KeyWithTs([]byte("foo"), ts)
+		require.Equal(t, suffix[:], key[3:])
+		require.Equal(t, ts, ParseTs(key))
+
+		SetKeyTs(key, 7)
+		require.Equal(t, uint64(7), ParseTs(key))
+	}
+	// The suffix is inverted and big endian.
+	require.Equal(t, [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, EncodeTsSuffix(1))
+	require.Equal(t, [8]byte{}, EncodeTsSuffix(math.MaxUint64))
+}
+
+func TestMinMaxKey(t *testing.T) {
+	k := func(key string, ts uint64) []byte { return KeyWithTs([]byte(key), ts) }
+
+	require.Nil(t, MinKey())
+	require.Nil(t, MaxKey())
+	require.Equal(t, k("a", 1), MinKey(k("a", 1)))
+	require.Equal(t, k("a", 1), MaxKey(k("a", 1)))
+
+	keys := [][]byte{k("b", 5), k("a", 1), k("c", 3), k("a", 7), k("c", 2)}
+	// Higher timestamps of the same key sort first.
+	require.Equal(t, k("a", 7), MinKey(keys...))
+	require.Equal(t, k("c", 2), MaxKey(keys...))
+	// Shorter keys sort first, regardless of the timestamps.
+	require.Equal(t, k("a", 0), MinKey(k("aa", math.MaxUint64), k("a", 0)))
+}
+
+func TestKeySuccessor(t *testing.T) {
+	require.Equal(t, []byte("b"), KeySuccessor([]byte("a")))
+	require.Equal(t, []byte("ac"), KeySuccessor([]byte("ab\xff")))
+	require.Equal(t, []byte("b"), KeySuccessor([]byte("a\xff\xff")))
+	require.Equal(t, []byte("a\x01"), KeySuccessor([]byte("a\x00")))
+	require.Nil(t, KeySuccessor([]byte("\xff\xff")))
+	require.Nil(t, KeySuccessor(nil))
+
+	// The prefix is not modified.
+	prefix := []byte("ab")
+	KeySuccessor(prefix)
+	require.Equal(t, []byte("ab"), prefix)
+}
+
+func TestKeysWithTs(t *testing.T) {
+	keys := [][]byte{[]byte("foo"), {}, []byte("a"), []byte("barbaz")}
+	out := KeysWithTs(keys, 42)
+	require.Len(t, out, len(keys))
+	for i, key := range keys {
+		require.Equal(t, KeyWithTs(key, 42), out[i])
+		require.Equal(t, len(out[i]), cap(out[i]))
+	}
+	// One allocation for the keys, and one for the slice holding them.
+	allocs := testing.AllocsPerRun(10, func() { out = KeysWithTs(keys, 42) })
+	require.Equal(t, float64(2), allocs)
+
+	// Appending to a key must not overwrite the next one.
+	_ = append(out[0], 'x')
+	require.Equal(t, KeyWithTs(keys[1], 42), out[1])
+
+	require.Empty(t, KeysWithTs(nil, 1))
+}
+
+func TestParseTsBatch(t *testing.T) {
+	keys := [][]byte{
+		KeyWithTs([]byte("foo"), 42),
+		nil,
+		[]byte("short"),
+		KeyWithTs(nil, 7), // Only 8 bytes long, which ParseTs treats as too short.
+		KeyWithTs([]byte("a"), math.MaxUint64),
+		KeyWithTs([]byte("barbaz"), 0),
+	}
+	require.Equal(t, []uint64{42, 0, 0, 0, math.MaxUint64, 0}, ParseTsBatch(keys))
+	require.Empty(t, ParseTsBatch(nil))
+}
+
 func TestPageBuffer(t *testing.T) {
 	rand.Seed(time.Now().Unix())
 
@@ -258,6 +391,1146 @@ func TestPagebufferReader4(t *testing.T) {
 	require.Equal(t, n, 0)
 }
 
+func TestPageBufferZeroValue(t *testing.T) {
+	var wb [1024]byte
+	rand.Read(wb[:])
+
+	b := &PageBuffer{}
+	require.Zero(t, b.Len())
+	n, err := b.Write(wb[:])
+	require.NoError(t, err, "unable to write bytes to buffer")
+	require.Equal(t, len(wb), n, "length of buffer and length written should be equal")
+	require.Equal(t, len(wb), b.Len())
+	require.True(t, bytes.Equal(wb[:], b.Bytes()), "bytes written and read should be equal")
+
+	rb := make([]byte, len(wb))
+	n, err = b.NewReaderAt(0).Read(rb)
+	require.NoError(t, err, "unable to read from reader")
+	require.Equal(t, len(wb), n)
+	require.True(t, bytes.Equal(wb[:], rb))
+}
+
+func TestPageBufferAppendBuffer(t *testing.T) {
+	rand.Seed(time.Now().Unix())
+
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	b := NewPageBuffer(32)
+	b.Write(wb[:100])
+	others := []*PageBuffer{NewPageBuffer(32), NewPageBuffer(64), {}}
+	others[0].Write(wb[100:150])
+	others[1].Write(wb[150:700])
+	others[2].Write(wb[700:])
+	for _, other := range others {
+		b.AppendBuffer(other)
+		require.Zero(t, other.Len())
+	}
+	require.Equal(t, len(wb), b.Len())
+	require.True(t, bytes.Equal(wb[:], b.Bytes()))
+
+	// Readers must step over pages which are not full, both from the start and from an offset.
+	rb, err := ioutil.ReadAll(b.NewReaderAt(0))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(wb[:], rb))
+	rb, err = ioutil.ReadAll(b.NewReaderAt(120))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(wb[120:], rb))
+
+	// Writes after appending go to the last page.
+	b.Write(wb[:10])
+	require.True(t, bytes.Equal(append(wb[:], wb[:10]...), b.Bytes()))
+}
+
+var _ io.ByteWriter = &PageBuffer{}
+
+func TestPageBufferWriteByte(t *testing.T) {
+	var bw io.ByteWriter = NewPageBuffer(32)
+	var want []byte
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, bw.WriteByte(byte(i)))
+		want = append(want, byte(i))
+	}
+	b := bw.(*PageBuffer)
+	require.Equal(t, len(want), b.Len())
+	require.True(t, bytes.Equal(want, b.Bytes()))
+}
+
+func TestPageBufferUvarint(t *testing.T) {
+	vals := []uint64{0, 1, 127, 128, 255, 300, 1 << 32, math.MaxUint64 - 1, math.MaxUint64}
+	b := NewPageBuffer(4)
+	for _, v := range vals {
+		var buf [binary.MaxVarintLen64]byte
+		require.Equal(t, binary.PutUvarint(buf[:], v), b.WriteUvarint(v))
+	}
+
+	r := b.NewReaderAt(0)
+	for _, v := range vals {
+		got, n, err := ReadUvarint(r)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+		var buf [binary.MaxVarintLen64]byte
+		require.Equal(t, binary.PutUvarint(buf[:], v), n)
+	}
+	_, n, err := ReadUvarint(r)
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, n)
+
+	// Truncated and overflowing varints.
+	_, _, err = ReadUvarint(bytes.NewReader([]byte{0x80, 0x80}))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	_, _, err = ReadUvarint(bytes.NewReader(bytes.Repeat([]byte{0xff}, 10)))
+	require.Error(t, err)
+}
+
+func TestMemHash(t *testing.T) {
+	require.Equal(t, MemHash([]byte("foo")), MemHash([]byte("foo")))
+	require.Equal(t, MemHash([]byte("foo")), MemHashString("foo"))
+	require.NotEqual(t, MemHash([]byte("foo")), MemHash([]byte("bar")))
+
+	const numBuckets, numKeys = 64, 10000
+	var buckets [numBuckets]int
+	for i := 0; i < numKeys; i++ {
+		buckets[MemHash([]byte(fmt.Sprintf("key%06d", i)))%numBuckets]++
+	}
+	// Each bucket expects ~156 keys. Allow for a generous deviation.
+	for i, n := range buckets {
+		require.True(t, n > numKeys/numBuckets/2 && n < numKeys/numBuckets*2,
+			"bucket %d has %d keys", i, n)
+	}
+}
+
+func TestCompareKeysAndSameKey(t *testing.T) {
+	var keys [][]byte
+	for _, k := range []string{"", "a", "aa", "ab", "b"} {
+		for _, ts := range []uint64{0, 1, 10, math.MaxUint64} {
+			keys = append(keys, KeyWithTs([]byte(k), ts))
+		}
+	}
+	for _, k1 := range keys {
+		for _, k2 := range keys {
+			cmp, same := CompareKeysAndSameKey(k1, k2)
+			require.Equal(t, CompareKeys(k1, k2), cmp)
+			require.Equal(t, SameKey(k1, k2), same)
+		}
+	}
+}
+
+func TestCompareKeysNoTs(t *testing.T) {
+	k1, k2 := KeyWithTs([]byte("a"), 1), KeyWithTs([]byte("a"), 10)
+	require.Zero(t, CompareKeysNoTs(k1, k2))
+	require.NotZero(t, CompareKeys(k1, k2))
+
+	require.Equal(t, -1, CompareKeysNoTs(KeyWithTs([]byte("a"), 10), KeyWithTs([]byte("aa"), 1)))
+	require.Equal(t, 1, CompareKeysNoTs(KeyWithTs([]byte("b"), 1), KeyWithTs([]byte("aa"), 10)))
+}
+
+func TestPageBufferEqual(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	// Buffers with different page sizes, so that their pages don't line up.
+	b1, b2 := NewPageBuffer(32), NewPageBuffer(100)
+	require.True(t, b1.Equal(b2))
+	b1.Write(wb[:])
+	b2.Write(wb[:])
+	require.True(t, b1.Equal(b2))
+	require.True(t, b2.Equal(b1))
+	require.True(t, b1.Equal(b1))
+
+	b3 := NewPageBuffer(32)
+	b3.Write(wb[:999])
+	require.False(t, b1.Equal(b3))
+	require.False(t, b3.Equal(b1))
+
+	// Same length, with content differing at the start, at a page boundary and at the end.
+	for _, off := range []int{0, 31, 32, 500, 999} {
+		diff := append([]byte{}, wb[:]...)
+		diff[off] ^= 1
+		b4 := NewPageBuffer(64)
+		b4.Write(diff)
+		require.False(t, b1.Equal(b4), "offset: %d", off)
+		require.False(t, b4.Equal(b2), "offset: %d", off)
+	}
+}
+
+func TestSliceResizeLimited(t *testing.T) {
+	var s Slice
+	buf, err := s.ResizeLimited(100, 100)
+	require.NoError(t, err)
+	require.Len(t, buf, 100)
+
+	buf, err = s.ResizeLimited(10, 100)
+	require.NoError(t, err)
+	require.Len(t, buf, 10)
+
+	buf, err = s.ResizeLimited(1<<30, 1<<20)
+	require.Error(t, err)
+	require.Nil(t, buf)
+	// The failed resize doesn't allocate.
+	require.Equal(t, 100, cap(s.buf))
+}
+
+func TestSearchU32(t *testing.T) {
+	s := BytesToU32Slice(U32SliceToBytes([]uint32{10, 20, 20, 30}))
+	for target, want := range map[uint32]int{
+		0: 0, 10: 0, 15: 1, 20: 1, 21: 3, 30: 3, 31: 4, math.MaxUint32: 4,
+	} {
+		require.Equal(t, want, SearchU32(s, target), "target: %d", target)
+	}
+	require.Zero(t, SearchU32(nil, 10))
+}
+
+func TestSearchOffsets(t *testing.T) {
+	// Offsets of the keys in data.
+	keys := []string{"apple", "banana", "cherry"}
+	var data []byte
+	var offsets []uint32
+	for _, k := range keys {
+		offsets = append(offsets, uint32(len(data)))
+		data = append(data, k...)
+	}
+	keyAt := func(i int) string {
+		end := len(data)
+		if i+1 < len(offsets) {
+			end = int(offsets[i+1])
+		}
+		return string(data[offsets[i]:end])
+	}
+	for target, want := range map[string]int{
+		"": 0, "apple": 0, "b": 1, "banana": 1, "cherry": 2, "date": 3,
+	} {
+		idx := SearchOffsets(offsets, func(i int) bool { return keyAt(i) >= target })
+		require.Equal(t, want, idx, "target: %q", target)
+	}
+	require.Zero(t, SearchOffsets(nil, func(i int) bool { return true }))
+}
+
+func TestPageBufferPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var wb [1000]byte
+	rand.Read(wb[:])
+	b := NewPageBuffer(32)
+	b.Write(wb[:])
+
+	for _, sync := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprintf("buf-%v", sync))
+		require.NoError(t, b.Persist(path, sync))
+		got, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, wb[:], got)
+
+		// The file already exists.
+		err = b.Persist(path, sync)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "While creating file")
+	}
+
+	path := filepath.Join(dir, "empty")
+	require.NoError(t, NewPageBuffer(32).Persist(path, true))
+	got, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestLatestVersions(t *testing.T) {
+	k := func(key string, ts uint64) []byte { return KeyWithTs([]byte(key), ts) }
+	keys := [][]byte{k("", 1), k("a", 9), k("a", 5), k("a", 1), k("aa", 3), k("b", 7), k("b", 2),
+		k("c", 1)}
+	want := [][]byte{k("", 1), k("a", 9), k("aa", 3), k("b", 7), k("c", 1)}
+	require.Equal(t, want, LatestVersions(keys))
+
+	require.Empty(t, LatestVersions(nil))
+	require.Equal(t, [][]byte{k("a", 1)}, LatestVersions([][]byte{k("a", 1)}))
+}
+
+func TestInsertSorted(t *testing.T) {
+	k := func(key string, ts uint64) []byte { return KeyWithTs([]byte(key), ts) }
+	keys := InsertSorted(nil, k("c", 1))
+	require.Equal(t, [][]byte{k("c", 1)}, keys)
+	keys = InsertSorted(keys, k("a", 1)) // Front.
+	keys = InsertSorted(keys, k("e", 1)) // End.
+	keys = InsertSorted(keys, k("b", 1)) // Middle.
+	keys = InsertSorted(keys, k("c", 5)) // Newer version of an existing key.
+	require.Equal(t, [][]byte{k("a", 1), k("b", 1), k("c", 5), k("c", 1), k("e", 1)}, keys)
+
+	// A duplicate is inserted after the existing key.
+	dup := k("b", 1)
+	keys = InsertSorted(keys, dup)
+	require.Len(t, keys, 6)
+	require.Equal(t, k("b", 1), keys[1])
+	require.True(t, &dup[0] == &keys[2][0])
+
+	var random [][]byte
+	for i := 0; i < 100; i++ {
+		random = InsertSorted(random, k(fmt.Sprintf("key%02d", rand.Intn(50)), uint64(rand.Intn(5))))
+	}
+	require.True(t, sort.SliceIsSorted(random, func(i, j int) bool {
+		return CompareKeys(random[i], random[j]) < 0
+	}))
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	k1, k2 := KeyWithTs([]byte("foo"), 1), KeyWithTs([]byte("foo"), 10)
+	require.Equal(t, KeyFingerprint(k1), KeyFingerprint(k2))
+	require.NotEqual(t, KeyFingerprint(k1), KeyFingerprint(KeyWithTs([]byte("bar"), 1)))
+
+	// sameUserKey uses fingerprints as a hint, and compares the keys when they match.
+	var compares int
+	sameUserKey := func(a, b []byte, fpA, fpB uint64) bool {
+		if fpA != fpB {
+			return false
+		}
+		compares++
+		return CompareKeysNoTs(a, b) == 0
+	}
+	require.True(t, sameUserKey(k1, k2, KeyFingerprint(k1), KeyFingerprint(k2)))
+	require.Equal(t, 1, compares)
+	k3 := KeyWithTs([]byte("bar"), 1)
+	require.False(t, sameUserKey(k1, k3, KeyFingerprint(k1), KeyFingerprint(k3)))
+	require.Equal(t, 1, compares)
+	// A collision is caught by the full comparison.
+	require.False(t, sameUserKey(k1, k3, 42, 42))
+	require.Equal(t, 2, compares)
+}
+
+func BenchmarkPageBufferWriteTo(b *testing.B) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+	buf := NewPageBuffer(1 << 10)
+	for buf.Len() < 1<<20 {
+		buf.Write(wb[:])
+	}
+
+	b.Run("buffer", func(b *testing.B) {
+		b.SetBytes(int64(buf.Len()))
+		for i := 0; i < b.N; i++ {
+			_, err := buf.WriteTo(ioutil.Discard)
+			Check(err)
+		}
+	})
+	b.Run("reader", func(b *testing.B) {
+		b.SetBytes(int64(buf.Len()))
+		for i := 0; i < b.N; i++ {
+			_, err := buf.NewReaderAt(0).WriteTo(ioutil.Discard)
+			Check(err)
+		}
+	})
+}
+
+func TestScratchSlice(t *testing.T) {
+	var s ScratchSlice
+	scratch := s.Scratch(10)
+	result := s.Result(20)
+	require.Len(t, scratch, 10)
+	require.Len(t, result, 20)
+	require.False(t, overlaps(scratch, result))
+	copy(scratch, "0123456789")
+	copy(result, "abcdefghijklmnopqrst")
+
+	// Appending to a region reallocates rather than overwriting the other one.
+	require.False(t, overlaps(append(scratch, 'x'), result))
+
+	// Smaller sizes don't reallocate.
+	require.True(t, overlaps(s.Scratch(5), scratch))
+	require.True(t, overlaps(s.Result(20), result))
+
+	// Contents survive growing either region.
+	scratch = s.Scratch(100)
+	result = s.Result(20)
+	require.False(t, overlaps(scratch, result))
+	require.Equal(t, "01234", string(scratch[:5]))
+	require.Equal(t, "abcdefghijklmnopqrst", string(result))
+
+	result = s.Result(1000)
+	scratch = s.Scratch(100)
+	require.False(t, overlaps(scratch, result))
+	require.Equal(t, "01234", string(scratch[:5]))
+	require.Equal(t, "abcdefghijklmnopqrst", string(result[:20]))
+}
+
+func TestPageBufferForEachPage(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	b := NewPageBuffer(32)
+	b.Write(wb[:])
+
+	var got []byte
+	var calls int
+	require.NoError(t, b.ForEachPage(func(p []byte) error {
+		got = append(got, p...)
+		calls++
+		return nil
+	}))
+	require.True(t, bytes.Equal(b.Bytes(), got))
+	require.Equal(t, len(b.pages), calls)
+
+	errStop := errors.New("stop")
+	calls = 0
+	err := b.ForEachPage(func(p []byte) error {
+		calls++
+		return errStop
+	})
+	require.Equal(t, errStop, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestPageBufferNonPositivePageSize(t *testing.T) {
+	var wb [2048]byte
+	rand.Read(wb[:])
+
+	for _, sz := range []int{0, -1} {
+		b := NewPageBuffer(sz)
+		n, err := b.Write(wb[:])
+		require.NoError(t, err)
+		require.Equal(t, len(wb), n)
+		require.True(t, bytes.Equal(wb[:], b.Bytes()))
+		require.Equal(t, defaultPageSize, cap(b.pages[0].buf))
+	}
+}
+
+func TestPageBufferWriteToPartialPage(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	// Pages of 32, 64 and 128 bytes, with the last one partially filled.
+	b := NewPageBuffer(32)
+	b.Write(wb[:100])
+	require.Len(t, b.pages, 3)
+	require.Equal(t, 4, len(b.pages[2].buf))
+
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(b.Len()), n)
+	require.Equal(t, wb[:100], buf.Bytes())
+
+	for _, off := range []int{0, 31, 32, 96, 99} {
+		buf.Reset()
+		r := b.NewReaderAt(off)
+		n, err := io.Copy(&buf, r)
+		require.NoError(t, err)
+		require.Equal(t, int64(b.Len()-off), n, "offset: %d", off)
+		require.Equal(t, wb[off:100], buf.Bytes(), "offset: %d", off)
+
+		// Data written later to the partial page can still be read.
+		c := b.Clone()
+		r = c.NewReaderAt(off)
+		buf.Reset()
+		_, err = r.WriteTo(&buf)
+		require.NoError(t, err)
+		c.Write(wb[100:110])
+		n, err = r.WriteTo(&buf)
+		require.NoError(t, err)
+		require.Equal(t, int64(10), n)
+		require.Equal(t, wb[off:110], buf.Bytes(), "offset: %d", off)
+	}
+
+	// Pages which aren't full before the last one, as left by AppendBuffer.
+	other := NewPageBuffer(32)
+	other.Write(wb[100:150])
+	b.AppendBuffer(other)
+	buf.Reset()
+	n, err = b.NewReaderAt(0).WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(b.Len()), n)
+	require.Equal(t, wb[:150], buf.Bytes())
+
+	n, err = b.NewReaderAt(10).WriteTo(&failingWriter{})
+	require.Error(t, err)
+	require.Zero(t, n)
+}
+
+func TestPageBufferInsertAt(t *testing.T) {
+	var wb [200]byte
+	rand.Read(wb[:])
+	ins := []byte("inserted")
+
+	for _, off := range []int{0, 30, 32, 100, 199, 200} {
+		b := NewPageBuffer(32)
+		b.Write(wb[:])
+		b.InsertAt(off, ins)
+
+		want := append(append(append([]byte{}, wb[:off]...), ins...), wb[off:]...)
+		require.Equal(t, want, b.Bytes(), "offset: %d", off)
+		require.Equal(t, len(want), b.Len())
+
+		// The buffer can still be written to and read from.
+		b.Write([]byte("end"))
+		got, err := ioutil.ReadAll(b.NewReaderAt(0))
+		require.NoError(t, err)
+		require.Equal(t, append(want, "end"...), got, "offset: %d", off)
+	}
+
+	// Inserting into an empty buffer, and inserting nothing.
+	b := NewPageBufferWithChecksum(32)
+	b.InsertAt(0, ins)
+	b.InsertAt(4, nil)
+	require.Equal(t, ins, b.Bytes())
+	b.InsertAt(4, wb[:50])
+	want := append(append(append([]byte{}, ins[:4]...), wb[:50]...), ins[4:]...)
+	require.Equal(t, want, b.Bytes())
+	require.Equal(t, uint32(CalculateChecksum(want, pb.Checksum_CRC32C)), b.Checksum())
+}
+
+func TestPagebufferReaderSeek(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	b := NewPageBuffer(32)
+	b.Write(wb[:])
+	var rs io.ReadSeeker = b.NewReaderAt(0)
+
+	read := func(n int) []byte {
+		buf := make([]byte, n)
+		m, err := io.ReadFull(rs, buf)
+		require.NoError(t, err)
+		require.Equal(t, n, m)
+		return buf
+	}
+
+	// Forward.
+	off, err := rs.Seek(100, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), off)
+	require.Equal(t, wb[100:150], read(50))
+	off, err = rs.Seek(200, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(350), off)
+	require.Equal(t, wb[350:400], read(50))
+
+	// Backward.
+	off, err = rs.Seek(-390, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), off)
+	require.Equal(t, wb[10:20], read(10))
+	off, err = rs.Seek(-96, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(904), off)
+	require.Equal(t, wb[904:], read(96))
+
+	// To the end, and past it.
+	off, err = rs.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(wb)), off)
+	n, err := rs.Read(make([]byte, 10))
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, n)
+	_, err = rs.Seek(1, io.SeekEnd)
+	require.Error(t, err)
+	_, err = rs.Seek(-1, io.SeekStart)
+	require.Error(t, err)
+
+	// Data written after seeking to the end is readable.
+	b.Write(wb[:10])
+	require.Equal(t, wb[:10], read(10))
+}
+
+func TestPageBufferWithMax(t *testing.T) {
+	var wb [1 << 16]byte
+	rand.Read(wb[:])
+
+	b := NewPageBufferWithMax(32, 1024)
+	for i := 0; i < 16; i++ {
+		b.Write(wb[:])
+	}
+	require.Equal(t, 16*len(wb), b.Len())
+	for i, p := range b.pages {
+		require.True(t, cap(p.buf) <= 1024, "page %d has size %d", i, cap(p.buf))
+	}
+	require.True(t, bytes.Equal(wb[:], b.Bytes()[:len(wb)]))
+	require.True(t, bytes.Equal(wb[:], b.Bytes()[15*len(wb):]))
+
+	// The first page is capped as well.
+	b = NewPageBufferWithMax(4096, 1024)
+	b.Write(wb[:2048])
+	for _, p := range b.pages {
+		require.Equal(t, 1024, cap(p.buf))
+	}
+}
+
+func TestPageBufferWithGrowth(t *testing.T) {
+	wb := make([]byte, 66000)
+	rand.Read(wb)
+
+	b := NewPageBufferWithGrowth(512, 1.5)
+	b.Write(wb)
+	require.True(t, bytes.Equal(wb, b.Bytes()))
+	require.Equal(t, 512, cap(b.pages[0].buf))
+	for i := 1; i < len(b.pages); i++ {
+		require.Equal(t, cap(b.pages[i-1].buf)*3/2, cap(b.pages[i].buf), "page %d", i)
+	}
+
+	// Doubling allocates more for the same data.
+	d := NewPageBuffer(512)
+	d.Write(wb)
+	require.Less(t, b.Cap(), d.Cap())
+
+	// Tiny pages still grow.
+	b = NewPageBufferWithGrowth(1, 1.1)
+	b.Write(wb[:100])
+	require.True(t, bytes.Equal(wb[:100], b.Bytes()))
+	require.Less(t, len(b.pages), 100)
+}
+
+func TestPageBufferReset(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	b := NewPageBuffer(32)
+	b.Write(wb[:])
+	require.True(t, b.Cap() >= len(wb))
+	b.Reset()
+	require.Zero(t, b.Len())
+	require.Equal(t, 32, b.Cap())
+	require.Empty(t, b.Bytes())
+
+	b.Write(wb[:100])
+	require.True(t, bytes.Equal(wb[:100], b.Bytes()))
+}
+
+func TestPageBufferPool(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	p := NewPageBufferPool(32, 512)
+	b := p.Get()
+	require.Zero(t, b.Len())
+	b.Write(wb[:100])
+	p.Put(b)
+
+	b = p.Get()
+	require.Zero(t, b.Len(), "buffers from the pool should be reset")
+	require.True(t, b.Cap() <= 512)
+
+	// Oversized buffers are dropped, so the next Get can't return it.
+	b.Write(wb[:])
+	p.Put(b)
+	b2 := p.Get()
+	require.True(t, b != b2)
+	require.Zero(t, b2.Len())
+	// The dropped buffer is left untouched.
+	require.True(t, bytes.Equal(wb[:], b.Bytes()))
+}
+
+func TestPageBufferFrames(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+	records := [][]byte{wb[:10], {}, wb[10:500], wb[500:501], wb[501:]}
+
+	b := NewPageBuffer(32)
+	total := 0
+	for _, rec := range records {
+		total += b.WriteFrame(rec)
+	}
+	require.Equal(t, b.Len(), total)
+
+	// Read frames back through both an io.ByteReader and a plain io.Reader.
+	readers := []io.Reader{b.NewReaderAt(0), struct{ io.Reader }{bytes.NewReader(b.Bytes())}}
+	for _, r := range readers {
+		for _, rec := range records {
+			got, err := NextFrame(r)
+			require.NoError(t, err)
+			require.Equal(t, len(rec), len(got))
+			require.True(t, bytes.Equal(rec, got))
+		}
+		_, err := NextFrame(r)
+		require.Equal(t, io.EOF, err)
+	}
+
+	// The third frame is truncated.
+	r := bytes.NewReader(b.Bytes()[:20])
+	for i := 0; i < 2; i++ {
+		_, err := NextFrame(r)
+		require.NoError(t, err)
+	}
+	_, err := NextFrame(r)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// Corrupt lengths return errors rather than allocating them.
+	var hdr [binary.MaxVarintLen64]byte
+	for _, sz := range []uint64{1 << 62, maxFrameSize + 1} {
+		n := binary.PutUvarint(hdr[:], sz)
+		_, err = NextFrame(bytes.NewReader(hdr[:n]))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "exceeds the limit")
+	}
+	// A plausible length with little data behind it is truncated.
+	n := binary.PutUvarint(hdr[:], maxFrameSize)
+	_, err = NextFrame(bytes.NewReader(append(hdr[:n], wb[:]...)))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// Frames spanning several read chunks.
+	big := make([]byte, 3*readChunkSize+10)
+	rand.Read(big)
+	b = NewPageBuffer(1024)
+	b.WriteFrame(big)
+	got, err := NextFrame(b.NewReaderAt(0))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(big, got))
+}
+
+var _ io.ReaderAt = &PageBuffer{}
+
+func TestPageBufferReadAt(t *testing.T) {
+	wb := make([]byte, 10000)
+	rand.Read(wb)
+
+	b := NewPageBuffer(32)
+	b.Write(wb)
+
+	buf := make([]byte, 100)
+	for _, off := range []int{0, 1, 31, 32, 95, 5000, 9900} {
+		n, err := b.ReadAt(buf, int64(off))
+		require.NoError(t, err)
+		require.Equal(t, len(buf), n)
+		require.True(t, bytes.Equal(wb[off:off+len(buf)], buf), "offset: %d", off)
+	}
+
+	// Reads past the end return the available bytes with io.EOF.
+	n, err := b.ReadAt(buf, 9950)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 50, n)
+	require.True(t, bytes.Equal(wb[9950:], buf[:n]))
+	n, err = b.ReadAt(buf, 10000)
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, n)
+	n, err = b.ReadAt(nil, 10000)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	_, err = b.ReadAt(buf, -1)
+	require.Error(t, err)
+
+	n, err = (&PageBuffer{}).ReadAt(buf, 0)
+	require.Equal(t, io.EOF, err)
+	require.Zero(t, n)
+
+	// Concurrent ReadAt calls are safe, as they don't modify b.
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			buf := make([]byte, 200)
+			for i := 0; i < 200; i++ {
+				off := r.Intn(len(wb) - len(buf))
+				n, err := b.ReadAt(buf, int64(off))
+				require.NoError(t, err)
+				require.True(t, bytes.Equal(wb[off:off+n], buf))
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+var _ io.WriterAt = &PageBuffer{}
+
+func TestPageBufferWriteAt(t *testing.T) {
+	var wb [100]byte
+	rand.Read(wb[:])
+
+	b := NewPageBuffer(32)
+	b.Write(wb[:])
+	want := Copy(wb[:])
+
+	// Patch a 4 byte header spanning the boundary of the first two pages.
+	n, err := b.WriteAt(U32ToBytes(0xdeadbeef), 30)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	copy(want[30:], U32ToBytes(0xdeadbeef))
+	require.True(t, bytes.Equal(want, b.Bytes()))
+
+	// Up to the end is fine.
+	n, err = b.WriteAt([]byte{1, 2, 3}, 97)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	copy(want[97:], []byte{1, 2, 3})
+	require.True(t, bytes.Equal(want, b.Bytes()))
+
+	// Past the end is not.
+	_, err = b.WriteAt([]byte{1, 2, 3}, 98)
+	require.Error(t, err)
+	_, err = b.WriteAt([]byte{1}, -1)
+	require.Error(t, err)
+	require.True(t, bytes.Equal(want, b.Bytes()))
+	require.Equal(t, len(wb), b.Len())
+}
+
+func TestPageBufferClone(t *testing.T) {
+	var wb [1000]byte
+	rand.Read(wb[:])
+
+	b := NewPageBuffer(32)
+	b.Write(wb[:500])
+	c := b.Clone()
+	require.Equal(t, b.Len(), c.Len())
+	require.True(t, bytes.Equal(wb[:500], c.Bytes()))
+
+	// Mutate the original, in place and by writing more.
+	b.WriteAt([]byte{^wb[0]}, 0)
+	b.Write(wb[500:])
+	require.Equal(t, 500, c.Len())
+	require.True(t, bytes.Equal(wb[:500], c.Bytes()))
+
+	// And the other way around.
+	c.Write(wb[:10])
+	require.Equal(t, len(wb), b.Len())
+	require.Equal(t, ^wb[0], b.Bytes()[0])
+	require.True(t, bytes.Equal(wb[1:], b.Bytes()[1:]))
+}
+
+var _ io.ReaderFrom = &PageBuffer{}
+
+func TestPageBufferReadFrom(t *testing.T) {
+	src := make([]byte, 3<<20)
+	rand.Read(src)
+
+	b := NewPageBuffer(1024)
+	b.Write(src[:10])
+	// Hide the WriterTo implementation of bytes.Reader, so that io.Copy uses ReadFrom.
+	n, err := io.Copy(b, struct{ io.Reader }{bytes.NewReader(src[10:])})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)-10), n)
+	require.Equal(t, len(src), b.Len())
+	require.True(t, bytes.Equal(src, b.Bytes()))
+
+	// Errors other than EOF are returned.
+	errFoo := errors.New("foo")
+	b = &PageBuffer{}
+	n, err = b.ReadFrom(io.MultiReader(bytes.NewReader(src[:100]), &errReader{err: errFoo}))
+	require.Equal(t, errFoo, err)
+	require.Equal(t, int64(100), n)
+	require.True(t, bytes.Equal(src[:100], b.Bytes()))
+}
+
+func TestPageBufferChecksum(t *testing.T) {
+	var wb [5000]byte
+	rand.Read(wb[:])
+	crc := func(b *PageBuffer) uint32 {
+		return uint32(CalculateChecksum(b.Bytes(), pb.Checksum_CRC32C))
+	}
+
+	b := NewPageBufferWithChecksum(32)
+	require.Equal(t, crc(b), b.Checksum())
+	b.Write(wb[:1000])
+	b.WriteByte(wb[1000])
+	b.WriteUvarint(1 << 40)
+	_, err := b.ReadFrom(bytes.NewReader(wb[1001:3000]))
+	require.NoError(t, err)
+	require.Equal(t, crc(b), b.Checksum())
+
+	// Patching data in place recomputes the checksum.
+	_, err = b.WriteAt([]byte{^wb[10]}, 10)
+	require.NoError(t, err)
+	require.Equal(t, crc(b), b.Checksum())
+	b.Write(wb[3000:])
+	require.Equal(t, crc(b), b.Checksum())
+
+	b.Truncate(2000)
+	require.Equal(t, crc(b), b.Checksum())
+
+	other := NewPageBufferWithChecksum(64)
+	other.Write(wb[:100])
+	b.AppendBuffer(other)
+	require.Equal(t, crc(b), b.Checksum())
+	other.Write(wb[:10])
+	require.Equal(t, crc(other), other.Checksum())
+
+	c := b.Clone()
+	c.Write(wb[:10])
+	require.Equal(t, crc(c), c.Checksum())
+	require.Equal(t, crc(b), b.Checksum())
+
+	b.Reset()
+	require.Equal(t, uint32(0), b.Checksum())
+	b.Write(wb[:10])
+	require.Equal(t, crc(b), b.Checksum())
+
+	// Without a running checksum, Checksum computes it over the data.
+	b = NewPageBuffer(32)
+	b.Write(wb[:])
+	require.Equal(t, crc(b), b.Checksum())
+	b.WriteAt([]byte{0}, 4000)
+	require.Equal(t, crc(b), b.Checksum())
+}
+
+func TestPageBufferFreeze(t *testing.T) {
+	var wb [10000]byte
+	rand.Read(wb[:])
+
+	b := NewPageBufferWithChecksum(32)
+	b.Write(wb[:])
+	b.Freeze()
+
+	mutations := map[string]func(){
+		"Write":        func() { b.Write(wb[:1]) },
+		"WriteByte":    func() { b.WriteByte(0) },
+		"ReadFrom":     func() { b.ReadFrom(bytes.NewReader(wb[:1])) },
+		"WriteAt":      func() { b.WriteAt(wb[:1], 0) },
+		"Truncate":     func() { b.Truncate(10) },
+		"Reset":        func() { b.Reset() },
+		"AppendBuffer": func() { b.AppendBuffer(NewPageBuffer(32)) },
+		"AppendOther":  func() { NewPageBuffer(32).AppendBuffer(b) },
+	}
+	for name, fn := range mutations {
+		require.PanicsWithValue(t, ErrPageBufferFrozen, fn, name)
+	}
+	require.True(t, bytes.Equal(wb[:], b.Bytes()))
+
+	// A clone can be modified.
+	c := b.Clone()
+	c.Write(wb[:10])
+	require.Equal(t, len(wb)+10, c.Len())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			off := i * 1000
+			got, err := ioutil.ReadAll(b.NewReaderAt(off))
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(wb[off:], got))
+			require.True(t, bytes.Equal(wb[:], b.Bytes()))
+			require.Equal(t, uint32(CalculateChecksum(wb[:], pb.Checksum_CRC32C)), b.Checksum())
+
+			var buf bytes.Buffer
+			_, err = b.WriteTo(&buf)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(wb[:], buf.Bytes()))
+		}(i)
+	}
+	wg.Wait()
+}
+
+// lenRecorder records the length of a PageBuffer every time it's written to.
+type lenRecorder struct {
+	bytes.Buffer
+	b    *PageBuffer
+	lens []int
+	caps []int
+}
+
+func (r *lenRecorder) Write(p []byte) (int, error) {
+	r.lens = append(r.lens, r.b.Len())
+	r.caps = append(r.caps, r.b.Cap())
+	return r.Buffer.Write(p)
+}
+
+func TestPageBufferDrain(t *testing.T) {
+	wb := make([]byte, 1<<20)
+	rand.Read(wb)
+
+	b := NewPageBufferWithMax(1024, 64<<10)
+	b.Write(wb)
+	w := &lenRecorder{b: b}
+	n, err := b.Drain(w, 4096)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(wb)), n)
+	require.True(t, bytes.Equal(wb, w.Bytes()))
+	require.Zero(t, b.Len())
+	require.Empty(t, b.Bytes())
+
+	// The buffer shrinks as it's drained.
+	require.Equal(t, len(wb), w.lens[0])
+	for i := 1; i < len(w.lens); i++ {
+		require.Less(t, w.lens[i], w.lens[i-1])
+		require.LessOrEqual(t, w.caps[i], w.caps[i-1])
+	}
+	require.Less(t, w.caps[len(w.caps)-1], 128<<10)
+
+	// The buffer is still usable afterwards.
+	b.Write(wb[:100])
+	require.True(t, bytes.Equal(wb[:100], b.Bytes()))
+
+	// On error, the data which wasn't written is kept.
+	errFoo := errors.New("foo")
+	b = NewPageBuffer(32)
+	b.Write(wb[:1000])
+	fw := &failingWriter{limit: 300, err: errFoo}
+	n, err = b.Drain(fw, 100)
+	require.Equal(t, errFoo, err)
+	require.Equal(t, int64(300), n)
+	require.True(t, bytes.Equal(wb[300:1000], b.Bytes()))
+	n, err = b.Drain(&fw.Buffer, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(700), n)
+	require.True(t, bytes.Equal(wb[:1000], fw.Bytes()))
+}
+
+func TestPageBufferDrainReset(t *testing.T) {
+	var wb [100]byte
+	rand.Read(wb[:])
+
+	// A page drained to its end keeps its capacity for later writes.
+	b := NewPageBuffer(32)
+	b.Write(wb[:32])
+	n, err := b.Drain(ioutil.Discard, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(32), n)
+	require.Equal(t, 32, b.Cap())
+
+	// Resetting the drained buffer, e.g. by PageBufferPool.Put, leaves it usable.
+	b.Reset()
+	b.Write(wb[:])
+	require.Equal(t, wb[:], b.Bytes())
+
+	p := NewPageBufferPool(32, 0)
+	pb := p.Get()
+	pb.Write(wb[:])
+	_, err = pb.Drain(ioutil.Discard, 10)
+	require.NoError(t, err)
+	p.Put(pb)
+	pb = p.Get()
+	pb.Write([]byte("x"))
+	require.Equal(t, []byte("x"), pb.Bytes())
+
+	// Reset also recovers a buffer whose only page has no capacity left.
+	b = NewPageBuffer(32)
+	b.pages[0].buf = b.pages[0].buf[:32][32:]
+	b.Reset()
+	b.Write(wb[:])
+	require.Equal(t, wb[:], b.Bytes())
+}
+
+// failingWriter fails with err once limit bytes have been written to it.
+type failingWriter struct {
+	bytes.Buffer
+	limit int
+	err   error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		n, _ := w.Buffer.Write(p[:w.limit-w.Len()])
+		return n, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestPageBufferSearchFrames(t *testing.T) {
+	b := NewPageBuffer(32)
+	_, ok := b.SearchFrames([]byte("a"), bytes.Compare)
+	require.False(t, ok)
+
+	var keys [][]byte
+	for i := 0; i < 500; i++ {
+		// Variable length keys, sorted, with gaps for absent keys.
+		key := []byte(fmt.Sprintf("key%04d%s", 2*i, bytes.Repeat([]byte{'x'}, i%7)))
+		keys = append(keys, key)
+		b.WriteFrame(key)
+	}
+	b.WriteFrame([]byte("zzz"))
+
+	for _, key := range keys {
+		rec, ok := b.SearchFrames(key, bytes.Compare)
+		require.True(t, ok, "key: %s", key)
+		require.Equal(t, key, rec)
+	}
+	rec, ok := b.SearchFrames([]byte("zzz"), bytes.Compare)
+	require.True(t, ok)
+	require.Equal(t, []byte("zzz"), rec)
+	for _, key := range []string{"a", "key0001", "key0999", "key1000", "zzzz"} {
+		_, ok := b.SearchFrames([]byte(key), bytes.Compare)
+		require.False(t, ok, "key: %s", key)
+	}
+
+	// The comparator can compare only part of a record, e.g. the key of a key-value pair.
+	b = NewPageBuffer(32)
+	for _, kv := range []string{"a=1", "b=22", "c=333"} {
+		b.WriteFrame([]byte(kv))
+	}
+	keyCmp := func(rec, target []byte) int {
+		return bytes.Compare(rec[:bytes.IndexByte(rec, '=')], target)
+	}
+	rec, ok = b.SearchFrames([]byte("b"), keyCmp)
+	require.True(t, ok)
+	require.Equal(t, []byte("b=22"), rec)
+
+	// Malformed frames are never found.
+	b = NewPageBuffer(32)
+	b.WriteFrame([]byte("foo"))
+	b.WriteUvarint(10)
+	b.Write([]byte("bar"))
+	_, ok = b.SearchFrames([]byte("foo"), bytes.Compare)
+	require.False(t, ok)
+}
+
+func TestPageBufferIndexFrames(t *testing.T) {
+	b := NewPageBuffer(32)
+	fi, err := b.IndexFrames()
+	require.NoError(t, err)
+	require.Equal(t, 0, fi.Len())
+	_, ok := fi.Search([]byte("a"), bytes.Compare)
+	require.False(t, ok)
+
+	var keys [][]byte
+	for i := 0; i < 500; i++ {
+		key := []byte(fmt.Sprintf("key%04d%s", 2*i, bytes.Repeat([]byte{'x'}, i%7)))
+		keys = append(keys, key)
+		b.WriteFrame(key)
+	}
+	b.WriteFrame(nil)
+	b.Freeze()
+
+	fi, err = b.IndexFrames()
+	require.NoError(t, err)
+	require.Equal(t, len(keys)+1, fi.Len())
+	// The empty frame sorts last under this comparator.
+	emptyLast := func(rec, target []byte) int {
+		switch {
+		case len(rec) == 0 && len(target) == 0:
+			return 0
+		case len(rec) == 0:
+			return 1
+		case len(target) == 0:
+			return -1
+		}
+		return bytes.Compare(rec, target)
+	}
+	for _, key := range keys {
+		rec, ok := fi.Search(key, emptyLast)
+		require.True(t, ok, "key: %s", key)
+		require.Equal(t, key, rec)
+	}
+	rec, ok := fi.Search(nil, emptyLast)
+	require.True(t, ok)
+	require.Empty(t, rec)
+	for _, key := range []string{"a", "key0001", "key0999", "key1000", "zzzz"} {
+		_, ok := fi.Search([]byte(key), emptyLast)
+		require.False(t, ok, "key: %s", key)
+	}
+
+	// A frame claiming more bytes than the buffer holds fails to index.
+	b = NewPageBuffer(32)
+	b.WriteFrame([]byte("foo"))
+	b.WriteUvarint(10)
+	b.Write([]byte("bar"))
+	_, err = b.IndexFrames()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exceeds the buffer length")
+
+	// So does a truncated length.
+	b = NewPageBuffer(32)
+	b.WriteFrame([]byte("foo"))
+	b.Write([]byte{0x80})
+	_, err = b.IndexFrames()
+	require.Error(t, err)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
 func TestSizeVarintForZero(t *testing.T) {
 	siz := sizeVarint(0)
 	require.Equal(t, 1, siz)
@@ -304,3 +1577,554 @@ func TestAllocatorReuse(t *testing.T) {
 	}
 	t.Logf("Allocator: %s\n", a)
 }
+
+func TestTempDir(t *testing.T) {
+	dir, cleanup, err := TempDir("badger-test")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(filepath.Base(dir), "badger-test"))
+	fi, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0600))
+
+	cleanup()
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+
+	// Cleanup is idempotent, and doesn't remove a directory created at the same path afterwards.
+	require.NoError(t, os.Mkdir(dir, 0700))
+	defer os.RemoveAll(dir)
+	cleanup()
+	_, err = os.Stat(dir)
+	require.NoError(t, err)
+}
+
+func TestAtomicWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "MANIFEST")
+	require.NoError(t, AtomicWriteFile(path, []byte("first"), true))
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), data)
+
+	// Overwrite the existing file.
+	require.NoError(t, AtomicWriteFile(path, []byte("second"), false))
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), data)
+
+	// No temp files should be left behind.
+	fis, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, fis, 1)
+	require.Equal(t, "MANIFEST", fis[0].Name())
+}
+
+func TestSyncDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := CreateSyncedFile(filepath.Join(dir, "000001.vlog"), true)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, SyncDir(dir))
+
+	require.Error(t, SyncDir(filepath.Join(dir, "missing")))
+}
+
+func TestCreateUniqueSyncedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Make the suffixes predictable, and pre-create the first candidate.
+	defer func(orig func() string) { uniqueFileSuffix = orig }(uniqueFileSuffix)
+	var calls int
+	uniqueFileSuffix = func() string {
+		calls++
+		return strconv.Itoa(calls)
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tmp-1"), []byte("foo"), 0600))
+
+	f, err := CreateUniqueSyncedFile(dir, "tmp-", true)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "tmp-2"), f.Name())
+	require.NoError(t, f.Close())
+	got, err := ioutil.ReadFile(filepath.Join(dir, "tmp-1"))
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(got))
+
+	// Gives up when all the candidates exist.
+	uniqueFileSuffix = func() string { return "1" }
+	_, err = CreateUniqueSyncedFile(dir, "tmp-", true)
+	require.Error(t, err)
+
+	_, err = CreateUniqueSyncedFile(filepath.Join(dir, "missing"), "tmp-", true)
+	require.Error(t, err)
+}
+
+func TestSyncFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var files []*os.File
+	for i := 0; i < 3*syncFilesConcurrency; i++ {
+		f, err := CreateSyncedFile(filepath.Join(dir, fmt.Sprintf("%06d.sst", i)), false)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = f.Write([]byte("foo"))
+		require.NoError(t, err)
+		files = append(files, f)
+	}
+	require.NoError(t, SyncFiles(files))
+	require.NoError(t, SyncFiles(nil))
+
+	// Syncing a closed file fails, which doesn't stop the other files from being synced.
+	closed, err := CreateSyncedFile(filepath.Join(dir, "closed.sst"), false)
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+	files = append(files[:5], append([]*os.File{closed}, files[5:]...)...)
+	err = SyncFiles(files)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "closed.sst")
+}
+
+func TestParseKeyInto(t *testing.T) {
+	key := KeyWithTs([]byte("foo"), 10)
+	dst := ParseKeyInto(nil, key)
+	require.Equal(t, []byte("foo"), dst)
+
+	// Mutating the key must not affect the parsed copy.
+	copy(key, "bar")
+	require.Equal(t, []byte("foo"), dst)
+
+	// dst is reused when it has enough capacity.
+	buf := make([]byte, 0, 16)
+	dst = ParseKeyInto(buf, key)
+	require.Equal(t, []byte("bar"), dst)
+	require.Equal(t, &buf[:1][0], &dst[0])
+
+	require.Empty(t, ParseKeyInto(nil, nil))
+}
+
+func TestSafeKeyString(t *testing.T) {
+	tests := []struct {
+		key  []byte
+		want string
+	}{
+		{KeyWithTs([]byte("foo"), 42), "foo@ts=42"},
+		{KeyWithTs([]byte("foo\x00bar"), 42), `foo\x00bar@ts=42`},
+		{KeyWithTs([]byte{0xff, '\\', '\n', 'a'}, 1), `\xff\x5c\x0aa@ts=1`},
+		{KeyWithTs([]byte("a@b"), math.MaxUint64), "a@b@ts=18446744073709551615"},
+		{KeyWithTs(nil, 7), "@ts=7"},
+		{[]byte("short"), "short"},
+		{[]byte{0x01}, `\x01`},
+		{nil, ""},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, SafeKeyString(tc.key), "key: %q", tc.key)
+	}
+}
+
+func TestEncodeComponents(t *testing.T) {
+	keys := [][][]byte{
+		{},
+		{{}},
+		{{}, {}},
+		{{}, []byte("a")},
+		{[]byte("a")},
+		{[]byte("a"), {}},
+		{[]byte("a"), {0}},
+		{[]byte("a"), {0, 0}},
+		{[]byte("a"), {0, 1}},
+		{[]byte("a"), {1}},
+		{[]byte("a"), []byte("b")},
+		{{'a', 0}},
+		{{'a', 0}, []byte("a")},
+		{{'a', 0, 0}},
+		{{'a', 1}},
+		{[]byte("aa")},
+		{{'a', 0xff}},
+		{[]byte("b")},
+		{{0xff}},
+		{{0xff, 0xff}, {0xff}},
+	}
+	// The keys above are sorted by their components, so the encoded keys must be sorted too.
+	encoded := make([][]byte, len(keys))
+	for i, parts := range keys {
+		encoded[i] = EncodeComponents(parts...)
+		if i > 0 {
+			require.Equal(t, -1, bytes.Compare(encoded[i-1], encoded[i]),
+				"%q should sort before %q", keys[i-1], parts)
+		}
+
+		decoded, err := DecodeComponents(encoded[i])
+		require.NoError(t, err)
+		require.Equal(t, len(parts), len(decoded))
+		for j := range parts {
+			require.True(t, bytes.Equal(parts[j], decoded[j]))
+		}
+	}
+
+	for _, invalid := range [][]byte{{0}, {0, 2}, []byte("a"), {'a', 0, 1, 'b'}} {
+		_, err := DecodeComponents(invalid)
+		require.Error(t, err, "key: %q", invalid)
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	key := KeyWithTs([]byte("tenant1/foo"), 10)
+	rest, ok := StripPrefix(key, []byte("tenant1/"))
+	require.True(t, ok)
+	require.Equal(t, []byte("foo"), ParseKey(rest))
+	require.Equal(t, uint64(10), ParseTs(rest))
+
+	rest, ok = StripPrefix(key, []byte("tenant2/"))
+	require.False(t, ok)
+	require.Equal(t, key, rest)
+
+	// The prefix must match the user key, not the timestamp suffix.
+	_, ok = StripPrefix(key, append([]byte("tenant1/foo"), 0))
+	require.False(t, ok)
+
+	// Prefix of the same length as the user key leaves only the timestamp.
+	rest, ok = StripPrefix(key, []byte("tenant1/foo"))
+	require.True(t, ok)
+	require.Equal(t, key[len(key)-8:], rest)
+
+	rest, ok = StripPrefix(key, nil)
+	require.True(t, ok)
+	require.Equal(t, key, rest)
+
+	_, ok = StripPrefix([]byte("abc"), nil)
+	require.False(t, ok)
+}
+
+func TestThrottleMismatch(t *testing.T) {
+	th := NewThrottle(2)
+	require.NoError(t, th.Do())
+	th.Done(nil)
+
+	defer func() {
+		r := recover()
+		require.NotNil(t, r, "Done without Do should panic")
+		err, ok := r.(error)
+		require.True(t, ok)
+		require.True(t, errors.Is(err, ErrThrottleMismatch))
+	}()
+	th.Done(nil)
+}
+
+func TestOpenExistingFileFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "KEYREGISTRY")
+	require.NoError(t, ioutil.WriteFile(path, []byte("foo"), 0600))
+
+	for _, flags := range []Flags{0, Sync, FullSync, Sync | FullSync, ReadOnly, ReadOnly | FullSync} {
+		f, err := OpenExistingFile(path, flags)
+		require.NoError(t, err, "flags: %d", flags)
+		if flags&ReadOnly == 0 {
+			_, err = f.WriteAt([]byte("bar"), 0)
+			require.NoError(t, err, "flags: %d", flags)
+		}
+		require.NoError(t, f.Close())
+	}
+	_, err = OpenExistingFile(filepath.Join(dir, "missing"), FullSync)
+	require.Error(t, err)
+}
+
+func TestSyncedFileWithFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "badger-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for i, flags := range []Flags{0, Sync, FullSync, Sync | FullSync} {
+		path := filepath.Join(dir, fmt.Sprintf("%06d.vlog", i))
+		f, err := CreateSyncedFileWithFlags(path, flags)
+		require.NoError(t, err, "flags: %d", flags)
+		_, err = f.Write([]byte("foo"))
+		require.NoError(t, err, "flags: %d", flags)
+		require.NoError(t, f.Close())
+
+		_, err = CreateSyncedFileWithFlags(path, flags)
+		require.True(t, os.IsExist(err), "flags: %d", flags)
+
+		f, err = OpenSyncedFileWithFlags(path, flags)
+		require.NoError(t, err, "flags: %d", flags)
+		_, err = f.WriteAt([]byte("bar"), 0)
+		require.NoError(t, err, "flags: %d", flags)
+		require.NoError(t, f.Close())
+	}
+}
+
+func TestThrottleFinishAll(t *testing.T) {
+	th := NewThrottle(3)
+	var want []error
+	for i := 0; i < 10; i++ {
+		err := fmt.Errorf("worker %d failed", i)
+		if i%3 == 0 {
+			err = nil
+		} else {
+			want = append(want, err)
+		}
+		// Do returns errors of finished workers. Keep going, as FinishAll collects them anyway.
+		for th.Do() != nil {
+		}
+		go th.Done(err)
+	}
+	require.ElementsMatch(t, want, th.FinishAll())
+
+	// Errors from sequential workers are returned in order.
+	th = NewThrottle(5)
+	want = want[:0]
+	for i := 0; i < 5; i++ {
+		for th.Do() != nil {
+		}
+		err := fmt.Errorf("worker %d failed", i)
+		want = append(want, err)
+		th.Done(err)
+	}
+	require.Equal(t, want, th.FinishAll())
+
+	th = NewThrottle(3)
+	require.NoError(t, th.Do())
+	th.Done(nil)
+	require.Empty(t, th.FinishAll())
+}
+
+func TestThrottleTryDo(t *testing.T) {
+	th := NewThrottle(2)
+	require.True(t, th.TryDo())
+	require.NoError(t, th.Do())
+	require.False(t, th.TryDo())
+
+	errFoo := errors.New("foo")
+	th.Done(errFoo)
+	require.True(t, th.TryDo())
+	require.False(t, th.TryDo())
+	th.Done(nil)
+	th.Done(nil)
+	// TryDo must not have consumed the error.
+	require.Equal(t, errFoo, th.Finish())
+}
+
+func TestThrottleHasError(t *testing.T) {
+	th := NewThrottle(3)
+	require.False(t, th.HasError())
+	require.Equal(t, 0, th.Errors())
+
+	require.NoError(t, th.Do())
+	th.Done(nil)
+	require.False(t, th.HasError())
+
+	errFoo, errBar := errors.New("foo"), errors.New("bar")
+	require.NoError(t, th.Do())
+	require.NoError(t, th.Do())
+	th.Done(errFoo)
+	th.Done(errBar)
+	require.True(t, th.HasError())
+	require.Equal(t, 2, th.Errors())
+	// Peeking must not consume the errors.
+	require.True(t, th.HasError())
+	require.Equal(t, 2, th.Errors())
+
+	require.Equal(t, errFoo, th.Finish())
+}
+
+func TestThrottleFinishWithWatchdog(t *testing.T) {
+	th := NewThrottle(3)
+	release := make(chan struct{})
+	errFoo := errors.New("foo")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, th.Do())
+		go func(i int) {
+			if i == 0 {
+				<-release // Stuck until released.
+				th.Done(errFoo)
+				return
+			}
+			th.Done(nil)
+		}(i)
+	}
+
+	stalls := make(chan int, 100)
+	finished := make(chan error)
+	go func() {
+		finished <- th.FinishWithWatchdog(time.Millisecond, func(running int) {
+			select {
+			case stalls <- running:
+			default: // Don't block the watchdog once the test stops listening.
+			}
+		})
+	}()
+
+	// Wait for the other workers to finish, leaving only the stuck one.
+	for running := <-stalls; running != 1; running = <-stalls {
+	}
+	select {
+	case <-finished:
+		t.Fatal("Finish returned with a worker still running")
+	default:
+	}
+
+	close(release)
+	require.Equal(t, errFoo, <-finished)
+
+	// Without stalls, onStall isn't called.
+	th = NewThrottle(1)
+	require.NoError(t, th.Do())
+	th.Done(nil)
+	require.NoError(t, th.FinishWithWatchdog(time.Hour, func(int) { t.Fatal("unexpected stall") }))
+}
+
+func TestPlausibleTs(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	skew := time.Hour
+	for _, ts := range []uint64{1, 12345, uint64(now.Unix()), uint64(now.UnixNano()),
+		uint64(now.Add(skew).UnixNano())} {
+		require.True(t, PlausibleTs(ts, now, skew), "ts: %d", ts)
+	}
+	for _, ts := range []uint64{0, uint64(now.Add(skew).UnixNano()) + 1, math.MaxUint64,
+		binary.LittleEndian.Uint64(U64ToBytes(12345))} { // Bytes in the wrong order.
+		require.False(t, PlausibleTs(ts, now, skew), "ts: %d", ts)
+	}
+	require.False(t, PlausibleTs(1, time.Unix(0, 0), 0))
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Unix(1600000000, 500)
+	require.Zero(t, EncodeExpiry(time.Time{}))
+	require.Equal(t, uint64(1600000000), EncodeExpiry(now))
+	require.Equal(t, uint64(1600000000), EncodeExpiry(now.In(time.FixedZone("UTC+5", 5*3600))))
+	require.Equal(t, uint64(1), EncodeExpiry(time.Unix(0, 0)))
+	require.Equal(t, uint64(1), EncodeExpiry(time.Unix(-100, 0)))
+
+	require.False(t, IsExpired(0, now))
+	require.False(t, IsExpired(0, time.Unix(math.MaxInt64, 0)))
+	require.True(t, IsExpired(EncodeExpiry(now.Add(-time.Hour)), now))
+	require.False(t, IsExpired(EncodeExpiry(now.Add(time.Hour)), now))
+	require.False(t, IsExpired(EncodeExpiry(now.Add(time.Second)), now))
+	// An entry expires at the start of its expiry second.
+	require.True(t, IsExpired(EncodeExpiry(now), now))
+	require.True(t, IsExpired(EncodeExpiry(now), now.Truncate(time.Second)))
+	require.False(t, IsExpired(EncodeExpiry(now), now.Add(-time.Second)))
+	require.True(t, IsExpired(EncodeExpiry(time.Unix(-100, 0)), now))
+}
+
+func TestFixedDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "00s"},
+		{999 * time.Millisecond, "00s"},
+		{5 * time.Second, "05s"},
+		{59 * time.Second, "59s"},
+		{time.Minute, "01m00s"},
+		{time.Hour - time.Second, "59m59s"},
+		{time.Hour, "01h00m00s"},
+		{25*time.Hour + 61*time.Second, "25h01m01s"},
+		{-5 * time.Second, "-05s"},
+		{-time.Hour, "-01h00m00s"},
+		{math.MinInt64, "-2562047h47m16s"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, FixedDuration(tc.d), "duration: %s", tc.d)
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{42, "42 B"},
+		{1023, "1023 B"},
+		{1024, "1 KiB"},
+		{1536, "1.5 KiB"},
+		{1<<20 - 1, "1 MiB"},
+		{1<<20 - 1<<10, "1023 KiB"},
+		{1<<30 - 1<<10, "1 GiB"},
+		{1 << 20, "1 MiB"},
+		{512 << 20, "512 MiB"},
+		{1 << 30, "1 GiB"},
+		{3 << 29, "1.5 GiB"},
+		{-1 << 30, "-1 GiB"},
+		{math.MaxInt64, "8 EiB"},
+		{math.MinInt64, "-8 EiB"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, HumanBytes(tc.n), "bytes: %d", tc.n)
+	}
+}
+
+func TestHumanBytesSI(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{999, "999 B"},
+		{1000, "1 KB"},
+		{1023, "1 KB"},
+		{1024, "1 KB"},
+		{1500, "1.5 KB"},
+		{1 << 20, "1 MB"},
+		{1 << 30, "1.1 GB"},
+		{999999, "1 MB"},
+		{999499, "999.5 KB"},
+		{-2500000, "-2.5 MB"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.want, HumanBytesSI(tc.n), "bytes: %d", tc.n)
+	}
+}
+
+func TestThrottleWithObserver(t *testing.T) {
+	waits := make(chan time.Duration, 2)
+	th := NewThrottleWithObserver(1, func(d time.Duration) { waits <- d })
+
+	require.NoError(t, th.Do())
+	require.True(t, <-waits < 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		th.Done(nil)
+	}()
+	// Blocks until the first worker is done.
+	require.NoError(t, th.Do())
+	require.True(t, <-waits >= 90*time.Millisecond)
+	th.Done(nil)
+	require.NoError(t, th.Finish())
+}
+
+func TestSlicePool(t *testing.T) {
+	p := NewSlicePool()
+	for _, sz := range []int{0, 1, 2, 3, 100, 1024, 1025} {
+		b := p.Get(sz)
+		require.Equal(t, sz, len(b))
+		require.True(t, cap(b) >= sz)
+		p.Put(b)
+	}
+
+	// A slice put back is returned by a Get from the same size class. sync.Pool randomly drops
+	// slices under the race detector, so try a few times.
+	reused := false
+	for i := 0; i < 100 && !reused; i++ {
+		b := p.Get(1000)
+		require.Equal(t, 1024, cap(b))
+		p.Put(b)
+		b2 := p.Get(600)
+		require.Equal(t, 600, len(b2))
+		reused = &b[:1][0] == &b2[:1][0]
+	}
+	require.True(t, reused)
+}